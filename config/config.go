@@ -1,11 +1,21 @@
 package config
 
 import (
+	"fmt"
 	"path/filepath"
+	"sort"
 
 	"gopkg.in/gcfg.v1"
 )
 
+const (
+	RetryModeWorker = "worker"
+	RetryModeQueue  = "queue"
+
+	UriOrderSequential = "sequential"
+	UriOrderRandom     = "random"
+)
+
 type Config struct {
 	RabbitMq struct {
 		Host        string
@@ -13,9 +23,21 @@ type Config struct {
 		Password    string
 		Port        string
 		Vhost       string
+		Uri         []string
+		UriOrder    string
 		Queue       string
 		Compression bool
 		Onfailure   int
+		ManualAck   bool
+	}
+	Tls struct {
+		Enabled    bool
+		CaFile     string
+		CertFile   string
+		KeyFile    string
+		ServerName string
+		MinVersion string
+		External   bool
 	}
 	Prefetch struct {
 		Count  int
@@ -34,13 +56,185 @@ type Config struct {
 		Durable    bool
 	}
 	Workers struct {
-		Count int
-		Queue int
+		Count           int
+		Queue           int
+		ShutdownTimeout int
+	}
+	Retry struct {
+		Mode         string
+		ParkingQueue string
+		MaxAttempts  int
+		Delay        int
+		MaxDelay     int
+		Jitter       float64
+	}
+	Handler struct {
+		Type string
+	}
+	Http struct {
+		Timeout         int
+		ForwardMetadata bool
+	}
+	Allow struct {
+		Scheme  []string
+		Host    []string
+		Network []string
+		Path    []string
+		Private bool
+	}
+	Limits struct {
+		Rate        float64
+		Burst       int
+		MaxInFlight int
+		OnLimit     string
+	}
+	Breaker struct {
+		Threshold int
+		Cooldown  int
+		OnOpen    string
+	}
+	Exec struct {
+		Command string
+		Arg     []string
+		Input   string
+		Base64  bool
+		Timeout int
+		Env     []string
+	}
+	Status struct {
+		Success []string
+		Retry   []string
+	}
+	Reconnect struct {
+		Delay       int
+		MaxDelay    int
+		MaxAttempts int
+	}
+	Rpc struct {
+		Enabled        bool
+		Header         []string
+		ConfirmTimeout int
+	}
+	Events struct {
+		Enabled        bool
+		Exchange       string
+		Routingkey     string
+		Body           bool
+		ConfirmTimeout int
+	}
+	Metrics struct {
+		Listen string
+	}
+	Health struct {
+		Listen string
 	}
 	Logs struct {
-		Error string
-		Info  string
+		Error  string
+		Info   string
+		Level  string
+		Format string
+	}
+	Consumer map[string]*ConsumerSection
+	Binding  map[string]*BindingSection
+	Limit    map[string]*LimitSection
+}
+
+// LimitSection limits rate and concurrency of requests by URL prefix.
+type LimitSection struct {
+	Prefix      string
+	Rate        float64
+	Burst       int
+	MaxInFlight int
+}
+
+// BindingSection binds queue to exchange, bindings without queue belong
+// to the main queue. Arguments are given as key=value pairs.
+type BindingSection struct {
+	Queue      string
+	Exchange   string
+	Routingkey string
+	Arg        []string
+}
+
+// ConsumerSection overrides queue specific settings of the main sections
+// for one named consumer, empty values are inherited.
+type ConsumerSection struct {
+	Queue        string
+	Routingkey   string
+	Exchange     string
+	ExchangeType string
+	Prefetch     int
+	Handler      string
+	Workers      int
+	WorkerQueue  int
+	Command      string
+	Arg          []string
+}
+
+// ConsumerNames returns sorted names of the consumer sections.
+func (cfg *Config) ConsumerNames() []string {
+	names := make([]string, 0, len(cfg.Consumer))
+	for name := range cfg.Consumer {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QueueBindings returns binding sections of the queue sorted by name.
+func (cfg *Config) QueueBindings() []*BindingSection {
+	names := make([]string, 0, len(cfg.Binding))
+	for name, b := range cfg.Binding {
+		if b != nil && (b.Queue == "" || b.Queue == cfg.RabbitMq.Queue) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	bindings := make([]*BindingSection, len(names))
+	for i, name := range names {
+		bindings[i] = cfg.Binding[name]
 	}
+	return bindings
+}
+
+// ConsumerConfig returns copy of the configuration with settings of the
+// named consumer section applied. Routing key is not inherited from the
+// main sections, the consumer would receive messages of the main queue.
+func (cfg *Config) ConsumerConfig(name string) *Config {
+	c := *cfg
+	c.Consumer = nil
+
+	s := cfg.Consumer[name]
+	if s == nil {
+		return &c
+	}
+
+	c.RabbitMq.Queue = s.Queue
+	c.QueueSettings.Routingkey = s.Routingkey
+	if s.Exchange != "" {
+		c.Exchange.Name = s.Exchange
+	}
+	if s.ExchangeType != "" {
+		c.Exchange.Type = s.ExchangeType
+	}
+	if s.Prefetch != 0 {
+		c.Prefetch.Count = s.Prefetch
+	}
+	if s.Handler != "" {
+		c.Handler.Type = s.Handler
+	}
+	if s.Workers != 0 {
+		c.Workers.Count = s.Workers
+	}
+	if s.WorkerQueue != 0 {
+		c.Workers.Queue = s.WorkerQueue
+	}
+	if s.Command != "" {
+		c.Exec.Command = s.Command
+		c.Exec.Arg = s.Arg
+	}
+	return &c
 }
 
 func LoadAndParse(location string) (*Config, error) {
@@ -56,5 +250,18 @@ func LoadAndParse(location string) (*Config, error) {
 	if err := gcfg.ReadFileInto(&cfg, location); err != nil {
 		return nil, err
 	}
+
+	for name, s := range cfg.Consumer {
+		if s == nil || s.Queue == "" {
+			return nil, fmt.Errorf("empty queue of consumer %q", name)
+		}
+	}
+
+	// Main queue is not consumed when there are consumer sections
+	for name, b := range cfg.Binding {
+		if len(cfg.Consumer) > 0 && (b == nil || b.Queue == "") {
+			return nil, fmt.Errorf("empty queue of binding %q", name)
+		}
+	}
 	return &cfg, nil
 }
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func loadConfig(t *testing.T, data string) (*Config, error) {
+	file, err := ioutil.TempFile("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	return LoadAndParse(file.Name())
+}
+
+func TestConsumerConfig(t *testing.T) {
+	cfg, err := loadConfig(t, `
+[rabbitmq]
+host = localhost
+queue = main
+
+[prefetch]
+count = 5
+
+[exchange]
+name = events
+type = topic
+
+[queuesettings]
+routingkey = "main.#"
+
+[exec]
+command = /bin/true
+arg = -v
+
+[consumer "orders"]
+queue = orders
+routingkey = "orders.#"
+prefetch = 10
+handler = exec
+command = /usr/bin/orders
+workers = 4
+
+[consumer "audit"]
+queue = audit
+exchange = audit
+exchangetype = fanout
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := cfg.ConsumerNames(); !reflect.DeepEqual(names, []string{"audit", "orders"}) {
+		t.Fatalf("invalid names, got %v", names)
+	}
+
+	orders := cfg.ConsumerConfig("orders")
+	if orders.RabbitMq.Queue != "orders" || orders.RabbitMq.Host != "localhost" {
+		t.Fatalf("invalid rabbitmq section, got %+v", orders.RabbitMq)
+	}
+	if orders.QueueSettings.Routingkey != "orders.#" || orders.Exchange.Name != "events" {
+		t.Fatalf("invalid binding, got %v to %v", orders.QueueSettings.Routingkey, orders.Exchange.Name)
+	}
+	if orders.Prefetch.Count != 10 || orders.Workers.Count != 4 || orders.Handler.Type != "exec" {
+		t.Fatalf("invalid overrides, got %+v", orders)
+	}
+	if orders.Exec.Command != "/usr/bin/orders" || len(orders.Exec.Arg) != 0 {
+		t.Fatalf("invalid exec section, got %+v", orders.Exec)
+	}
+	if orders.Consumer != nil {
+		t.Fatal("consumer sections should not be copied")
+	}
+
+	audit := cfg.ConsumerConfig("audit")
+	if audit.Exchange.Name != "audit" || audit.Exchange.Type != "fanout" || audit.Prefetch.Count != 5 {
+		t.Fatalf("invalid audit config, got %+v", audit)
+	}
+	if audit.QueueSettings.Routingkey != "" {
+		t.Fatalf("routing key should not be inherited, got %v", audit.QueueSettings.Routingkey)
+	}
+
+	if cfg.RabbitMq.Queue != "main" || cfg.Prefetch.Count != 5 {
+		t.Fatal("main sections should not be modified")
+	}
+}
+
+func TestConsumerEmptyQueue(t *testing.T) {
+	if _, err := loadConfig(t, "[consumer \"orders\"]\nprefetch = 1\n"); err == nil {
+		t.Fatal("expected error for empty queue")
+	}
+}
+
+func TestQueueBindings(t *testing.T) {
+	cfg, err := loadConfig(t, `
+[rabbitmq]
+queue = orders
+
+[binding "created"]
+exchange = orders
+routingkey = "order.*.created"
+
+[binding "cancelled"]
+routingkey = "order.*.cancelled"
+
+[binding "pdf"]
+queue = documents
+exchange = documents
+arg = x-match=all
+arg = format=pdf
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bindings := cfg.QueueBindings()
+	if len(bindings) != 2 || bindings[0].Routingkey != "order.*.cancelled" || bindings[1].Exchange != "orders" {
+		t.Fatalf("invalid bindings of main queue, got %+v", bindings)
+	}
+
+	cfg.RabbitMq.Queue = "documents"
+	bindings = cfg.QueueBindings()
+	if len(bindings) != 3 || !reflect.DeepEqual(bindings[2].Arg, []string{"x-match=all", "format=pdf"}) {
+		t.Fatalf("invalid bindings of documents queue, got %+v", bindings)
+	}
+}
+
+func TestBindingEmptyQueue(t *testing.T) {
+	_, err := loadConfig(t, `
+[consumer "orders"]
+queue = orders
+
+[binding "created"]
+exchange = orders
+`)
+	if err == nil {
+		t.Fatal("expected error for binding without queue")
+	}
+}
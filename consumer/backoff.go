@@ -0,0 +1,24 @@
+package consumer
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff returns exponentially growing delay for given attempt starting at 1,
+// capped at max and randomized by up to half of its value.
+func backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base := time.Second
+	max := time.Second * 10
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: time.Second * 2},
+		{attempt: 3, want: time.Second * 4},
+		{attempt: 4, want: time.Second * 8},
+		{attempt: 5, want: time.Second * 10},
+		{attempt: 50, want: time.Second * 10},
+	}
+
+	for _, c := range cases {
+		got := backoff(c.attempt, base, max)
+		if got < c.want/2 || got > c.want {
+			t.Fatalf("invalid backoff for attempt %v, got %v, want between %v and %v", c.attempt, got, c.want/2, c.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	EncodingGzip = "gzip"
+	EncodingZlib = "zlib"
+)
+
+// decompress decodes body according to the content encoding of the delivery,
+// bodies without content encoding are treated as zlib. Bodies are passed
+// unchanged when compression is off or the encoding is not a known codec,
+// producers often set content encoding to a charset like utf-8.
+func decompress(body []byte, encoding string, compression bool) ([]byte, error) {
+	if !compression {
+		return body, nil
+	}
+
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	if encoding == "" {
+		encoding = EncodingZlib
+	}
+
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case EncodingZlib, "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return body, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v stream: %v", encoding, err)
+	}
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v stream: %v", encoding, err)
+	}
+	return data, nil
+}
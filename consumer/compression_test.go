@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	data := []byte(`{"request_params":{"uri":"http://localhost","method":"GET"}}`)
+
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write(data)
+	zw.Close()
+
+	var gbuf bytes.Buffer
+	gw := gzip.NewWriter(&gbuf)
+	gw.Write(data)
+	gw.Close()
+
+	cases := []struct {
+		body        []byte
+		encoding    string
+		compression bool
+	}{
+		{body: data, encoding: "", compression: false},
+		{body: data, encoding: "utf-8", compression: false},
+		{body: data, encoding: "utf-8", compression: true},
+		{body: data, encoding: "gzip", compression: false},
+		{body: zbuf.Bytes(), encoding: "", compression: true},
+		{body: zbuf.Bytes(), encoding: "zlib", compression: true},
+		{body: zbuf.Bytes(), encoding: "deflate", compression: true},
+		{body: gbuf.Bytes(), encoding: "gzip", compression: true},
+		{body: gbuf.Bytes(), encoding: "GZIP", compression: true},
+	}
+
+	for _, c := range cases {
+		got, err := decompress(c.body, c.encoding, c.compression)
+		if err != nil {
+			t.Fatalf("could not decompress, encoding=%v: %v", c.encoding, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("invalid data, got %s, want %s", got, data)
+		}
+	}
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	data := []byte("not compressed")
+
+	cases := []struct {
+		encoding    string
+		compression bool
+	}{
+		{encoding: "", compression: true},
+		{encoding: "gzip", compression: true},
+		{encoding: "zlib", compression: true},
+	}
+
+	for _, c := range cases {
+		if _, err := decompress(data, c.encoding, c.compression); err == nil {
+			t.Fatalf("expected error, encoding=%v", c.encoding)
+		}
+	}
+}
@@ -1,81 +1,122 @@
 package consumer
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"net/url"
-
+	"os"
+	"strings"
 	"time"
 
 	"github.com/jbub/rabbitmq-cli-consumer/config"
 	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
 	"github.com/streadway/amqp"
 )
 
 const (
 	EmptyString = "<empty>"
+
+	cancelGracePeriod = time.Second * 5
+	statsInterval     = time.Minute
+
+	// Failed messages are acked once moving them to the retry queue is
+	// confirmed.
+	retryConfirmTimeout = time.Second * 5
 )
 
-func New(cfg *config.Config, jb domain.JobBuilder, httpTimeout time.Duration, debugLogger *log.Logger, errLogger *log.Logger, infLogger *log.Logger) (*Consumer, error) {
-	uri := fmt.Sprintf(
-		"amqp://%s:%s@%s:%s%s",
-		url.QueryEscape(cfg.RabbitMq.Username),
-		url.QueryEscape(cfg.RabbitMq.Password),
-		cfg.RabbitMq.Host,
-		cfg.RabbitMq.Port,
-		cfg.RabbitMq.Vhost,
-	)
+// Values of RabbitMq.Onfailure, used when a job fails in manual ack mode.
+const (
+	OnFailureRequeue = iota // nack with requeue
+	OnFailureAck            // ack and drop the message
+	OnFailureReject         // reject without requeue, dead letter exchange takes it
+)
 
-	conn, err := amqp.Dial(uri)
-	if nil != err {
-		return nil, fmt.Errorf("failed connecting RabbitMQ: %v", err)
-	}
+// Values of RabbitMq.Onfailure of the original rabbitmq-cli-consumer, they
+// match the exit codes of the executed command.
+const (
+	OnFailureRejectDrop    = 3 // reject without requeue
+	OnFailureRejectRequeue = 4 // reject with requeue
+	OnFailureNackDrop      = 5 // nack without requeue
+	OnFailureNackRequeue   = 6 // nack with requeue
+)
 
-	ch, err := conn.Channel()
-	if nil != err {
-		return nil, fmt.Errorf("failed to open a channel: %v", err)
+func New(session *Session, cfg *config.Config, jb domain.JobBuilder, httpTimeout time.Duration, logger *logging.Logger) (*Consumer, error) {
+	switch cfg.RabbitMq.Onfailure {
+	case OnFailureRequeue, OnFailureAck, OnFailureReject:
+	case OnFailureRejectDrop, OnFailureRejectRequeue, OnFailureNackDrop, OnFailureNackRequeue:
+	default:
+		return nil, fmt.Errorf("invalid onfailure value: %v", cfg.RabbitMq.Onfailure)
+	}
+	if cfg.RabbitMq.Onfailure != OnFailureRequeue && !cfg.RabbitMq.ManualAck {
+		logger.Warnf("onfailure %v has no effect without manual ack, messages are acked on delivery", cfg.RabbitMq.Onfailure)
 	}
 
 	// Attempt to preserve BC here
 	if cfg.Prefetch.Count == 0 {
 		cfg.Prefetch.Count = 3
 	}
-	if err := ch.Qos(cfg.Prefetch.Count, 0, cfg.Prefetch.Global); err != nil {
-		return nil, fmt.Errorf("failed to set QoS: %v", err)
-	}
-
-	if _, err := ch.QueueDeclare(cfg.RabbitMq.Queue, true, false, false, false, sanitizeQueueArgs(cfg)); err != nil {
-		return nil, fmt.Errorf("failed to declare queue: %v", err)
-	}
 
 	// Check for missing exchange settings to preserve BC
 	if "" == cfg.Exchange.Name && "" == cfg.Exchange.Type && !cfg.Exchange.Durable && !cfg.Exchange.Autodelete {
 		cfg.Exchange.Type = "direct"
 	}
 
-	// Empty Exchange name means default, no need to declare
-	if "" != cfg.Exchange.Name {
-		if err := ch.ExchangeDeclare(cfg.Exchange.Name, cfg.Exchange.Type, cfg.Exchange.Durable, cfg.Exchange.Autodelete, false, false, amqp.Table{}); err != nil {
-			return nil, fmt.Errorf("failed to declare exchange: %v", err)
-		}
+	if cfg.Workers.ShutdownTimeout == 0 {
+		cfg.Workers.ShutdownTimeout = 30000
+	}
 
-		// Bind queue
-		if err := ch.QueueBind(cfg.RabbitMq.Queue, transformToStringValue(cfg.QueueSettings.Routingkey), transformToStringValue(cfg.Exchange.Name), false, nil); err != nil {
-			return nil, fmt.Errorf("failed to bind queue to exchange: %v", err)
+	switch cfg.Retry.Mode {
+	case "":
+		cfg.Retry.Mode = config.RetryModeWorker
+	case config.RetryModeWorker, config.RetryModeQueue:
+	default:
+		return nil, fmt.Errorf("invalid retry mode: %v", cfg.Retry.Mode)
+	}
+	if cfg.Retry.Mode == config.RetryModeQueue {
+		if cfg.Retry.MaxAttempts < 0 {
+			return nil, fmt.Errorf("invalid retry max attempts: %v", cfg.Retry.MaxAttempts)
+		}
+		if cfg.Retry.MaxAttempts == 0 {
+			cfg.Retry.MaxAttempts = 5
+		}
+		if cfg.Retry.Delay == 0 {
+			cfg.Retry.Delay = 1000
 		}
+		if cfg.Retry.ParkingQueue == "" {
+			cfg.Retry.ParkingQueue = cfg.RabbitMq.Queue + ".parking"
+		}
+	}
+
+	if cfg.Rpc.Enabled && cfg.Rpc.ConfirmTimeout == 0 {
+		cfg.Rpc.ConfirmTimeout = 5000
+	}
+	if cfg.Events.Enabled && cfg.Events.ConfirmTimeout == 0 {
+		cfg.Events.ConfirmTimeout = 5000
+	}
+
+	if cfg.Reconnect.Delay == 0 {
+		cfg.Reconnect.Delay = 1000
+	}
+	if cfg.Reconnect.MaxDelay == 0 {
+		cfg.Reconnect.MaxDelay = 30000
 	}
 
-	return &Consumer{
+	c := &Consumer{
 		Cfg:         cfg,
-		Channel:     ch,
-		Connection:  conn,
 		Queue:       cfg.RabbitMq.Queue,
 		JobBuilder:  jb,
 		HttpTimeout: httpTimeout,
-		DebugLogger: debugLogger,
-		ErrLogger:   errLogger,
-		InfLogger:   infLogger,
-	}, nil
+		Logger:      logger,
+		session:     session,
+		tag:         fmt.Sprintf("rabbitmq-cli-consumer-%v", os.Getpid()),
+		probes:      make(chan struct{}),
+		callbacks:   newCallbacks(),
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 type Consumer struct {
@@ -83,71 +124,565 @@ type Consumer struct {
 	Channel     *amqp.Channel
 	Connection  *amqp.Connection
 	Queue       string
-	DebugLogger *log.Logger
-	ErrLogger   *log.Logger
-	InfLogger   *log.Logger
+	Logger      *logging.Logger
 	JobBuilder  domain.JobBuilder
 	HttpTimeout time.Duration
+	session     *Session
+	replies     *publisher
+	events      *publisher
+	retries     *publisher
+	tag         string
+	msgs        <-chan amqp.Delivery
+	pending     int
+	confirming  int
+	callbacks   *callbacks
+	probes      chan struct{}
+	state       state
+	stats       stats
+}
+
+func (c *Consumer) connect() error {
+	conn, ch, err := c.session.channel()
+	if err != nil {
+		return err
+	}
+
+	if err := declare(ch, c.Cfg); err != nil {
+		ch.Close()
+		return err
+	}
+
+	if err := c.openPublishers(); err != nil {
+		c.closePublishers()
+		ch.Close()
+		return err
+	}
+
+	c.Connection = conn
+	c.Channel = ch
+	c.state.set(func(s *status) { s.connected = true })
+	return nil
+}
+
+func declare(ch *amqp.Channel, cfg *config.Config) error {
+	if err := ch.Qos(cfg.Prefetch.Count, 0, cfg.Prefetch.Global); err != nil {
+		return fmt.Errorf("failed to set QoS: %v", err)
+	}
+
+	if _, err := ch.QueueDeclare(cfg.RabbitMq.Queue, true, false, false, false, sanitizeQueueArgs(cfg)); err != nil {
+		return fmt.Errorf("failed to declare queue: %v", err)
+	}
+
+	// Empty Exchange name means default, no need to declare
+	if "" != cfg.Exchange.Name {
+		if err := ch.ExchangeDeclare(cfg.Exchange.Name, cfg.Exchange.Type, cfg.Exchange.Durable, cfg.Exchange.Autodelete, false, false, amqp.Table{}); err != nil {
+			return fmt.Errorf("failed to declare exchange: %v", err)
+		}
+	}
+
+	bindings := cfg.QueueBindings()
+
+	// Attempt to preserve BC here, binding sections replace the routing key
+	if len(bindings) == 0 && "" != cfg.Exchange.Name {
+		if err := ch.QueueBind(cfg.RabbitMq.Queue, transformToStringValue(cfg.QueueSettings.Routingkey), transformToStringValue(cfg.Exchange.Name), false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue to exchange: %v", err)
+		}
+	}
+
+	for _, b := range bindings {
+		if err := bind(ch, cfg, b); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Retry.Mode == config.RetryModeQueue {
+		if err := declareRetryQueues(ch, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) openPublishers() error {
+	var err error
+	c.replies, c.events, c.retries = nil, nil, nil
+	if c.Cfg.Rpc.Enabled {
+		if c.replies, err = c.openPublisher(time.Duration(c.Cfg.Rpc.ConfirmTimeout) * time.Millisecond); err != nil {
+			return err
+		}
+	}
+	if c.Cfg.Events.Enabled {
+		if c.events, err = c.openEvents(); err != nil {
+			return err
+		}
+	}
+	if c.Cfg.Retry.Mode == config.RetryModeQueue {
+		if c.retries, err = c.openPublisher(retryConfirmTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func ConnectionCloseHandler(closeErr chan *amqp.Error, c *Consumer) {
-	err := <-closeErr
-	c.ErrLogger.Fatalf("connection closed: %v", err)
+func (c *Consumer) closePublishers() {
+	c.replies.close()
+	c.events.close()
+	c.retries.close()
 }
 
-func (c *Consumer) Consume() {
-	msgs, err := c.Channel.Consume(c.Queue, "", true, false, false, false, nil)
+// openPublisher opens another channel on the connection for publishing
+// with confirms.
+func (c *Consumer) openPublisher(timeout time.Duration) (*publisher, error) {
+	_, ch, err := c.session.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := newPublisher(ch, timeout, c.callbacks)
 	if err != nil {
-		c.ErrLogger.Fatalf("failed to register a consumer: %s", err)
+		ch.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func bind(ch *amqp.Channel, cfg *config.Config, b *config.BindingSection) error {
+	exchange := b.Exchange
+	if exchange == "" {
+		exchange = cfg.Exchange.Name
+	}
+	if exchange == "" {
+		return fmt.Errorf("empty exchange of binding with routing key %v", b.Routingkey)
+	}
+
+	args, err := bindingArgs(b.Arg)
+	if err != nil {
+		return fmt.Errorf("invalid binding to exchange %v: %v", exchange, err)
+	}
+
+	if err := ch.QueueBind(cfg.RabbitMq.Queue, transformToStringValue(b.Routingkey), exchange, false, args); err != nil {
+		return fmt.Errorf("failed to bind queue to exchange %v with routing key %v: %v", exchange, b.Routingkey, err)
+	}
+	return nil
+}
+
+// bindingArgs parses key=value pairs, e.g. x-match=all for headers exchange.
+func bindingArgs(pairs []string) (amqp.Table, error) {
+	if len(pairs) == 0 {
+		return nil, nil
 	}
 
-	defer c.Connection.Close()
-	defer c.Channel.Close()
+	args := make(amqp.Table, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid argument %q, expected key=value", pair)
+		}
+		args[parts[0]] = parts[1]
+	}
+	return args, nil
+}
 
-	closeErr := make(chan *amqp.Error)
-	closeErr = c.Connection.NotifyClose(closeErr)
+// reconnect opens the channel again with exponential backoff, finished
+// jobs are still handled while waiting so that workers do not block.
+func (c *Consumer) reconnect(ctx context.Context, pool *Pool) error {
+	c.state.set(func(s *status) { s.connected = false })
+	c.Channel.Close()
+	c.closePublishers()
+
+	delay := time.Duration(c.Cfg.Reconnect.Delay) * time.Millisecond
+	maxDelay := time.Duration(c.Cfg.Reconnect.MaxDelay) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		wait := backoff(attempt, delay, maxDelay)
+		c.Logger.Infof("reconnecting in %v, attempt=%v ...", wait, attempt)
+
+		timer := time.NewTimer(wait)
+	sleep:
+		for {
+			select {
+			case <-timer.C:
+				break sleep
+			case res := <-pool.Results:
+				c.handleResult(res)
+			case <-c.callbacks.ready:
+				c.callbacks.run()
+			case <-c.probes:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		err := c.connect()
+		if err == nil {
+			metrics.Reconnects.Inc()
+			c.Logger.Infof("reconnected, attempt=%v", attempt)
+			return nil
+		}
 
-	go ConnectionCloseHandler(closeErr, c)
+		c.Logger.Errorf("could not reconnect, attempt=%v: %v", attempt, err)
+		if c.Cfg.Reconnect.MaxAttempts > 0 && attempt >= c.Cfg.Reconnect.MaxAttempts {
+			return fmt.Errorf("giving up after %v attempts: %v", attempt, err)
+		}
+	}
+}
 
-	c.InfLogger.Printf("using %v workers ...", c.Cfg.Workers.Count)
-	c.InfLogger.Printf("using worker queue of length %v ...", c.Cfg.Workers.Queue)
-	c.InfLogger.Printf("using http timeout %v ...", c.HttpTimeout)
-	c.InfLogger.Printf("waiting for messages ...")
+// Consume delivers messages to the worker pool until ctx is cancelled, then
+// drains in-flight jobs and closes the connection.
+func (c *Consumer) Consume(ctx context.Context) error {
+	c.Logger.Infof("using %v workers ...", c.Cfg.Workers.Count)
+	c.Logger.Infof("using worker queue of length %v ...", c.Cfg.Workers.Queue)
+	c.Logger.Infof("using http timeout %v ...", c.HttpTimeout)
+	c.Logger.Infof("using manual ack %v ...", c.Cfg.RabbitMq.ManualAck)
+	c.Logger.Infof("using on failure %v ...", c.Cfg.RabbitMq.Onfailure)
+	c.Logger.Infof("using compression %v ...", c.Cfg.RabbitMq.Compression)
+	c.Logger.Infof("using retry mode %v ...", c.Cfg.Retry.Mode)
+
+	pool := NewPool(c.Queue, c.Cfg.Workers.Count, c.Cfg.Workers.Queue, c.Logger)
+	c.state.set(func(s *status) { s.pool = pool })
+
+	for {
+		err := c.consume(ctx, pool)
+		if err == nil {
+			break
+		}
+		c.Logger.Errorf("connection lost: %v", err)
 
-	pool := NewPool(c.Cfg.Workers.Count, c.Cfg.Workers.Queue, c.InfLogger, c.ErrLogger)
-	defer pool.Release()
+		if err := c.reconnect(ctx, pool); err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("failed reconnecting RabbitMQ: %v", err)
+		}
+	}
+
+	c.shutdown(pool)
+	return nil
+}
+
+// consume delivers messages to the pool until the connection or channel
+// is closed, in-flight jobs are kept in the pool. Returns nil when ctx is
+// cancelled.
+func (c *Consumer) consume(ctx context.Context, pool *Pool) error {
+	connClose := c.Connection.NotifyClose(make(chan *amqp.Error, 1))
+	chanClose := c.Channel.NotifyClose(make(chan *amqp.Error, 1))
+
+	cancelled := c.Channel.NotifyCancel(make(chan string, 1))
+
+	repliesClose := c.replies.notifyClose()
+	eventsClose := c.events.notifyClose()
+	retriesClose := c.retries.notifyClose()
+
+	msgs, err := c.Channel.Consume(c.Queue, c.tag, !c.Cfg.RabbitMq.ManualAck, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %v", err)
+	}
+	c.msgs = msgs
+
+	c.state.set(func(s *status) { s.consuming = true })
+	defer c.state.set(func(s *status) { s.consuming = false })
+
+	c.Logger.Infof("waiting for messages ...")
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				// Wait for the close notification
+				msgs = nil
+				break
+			}
+			c.handleDelivery(pool, d)
+		case res := <-pool.Results:
+			c.handleResult(res)
+		case <-c.callbacks.ready:
+			c.callbacks.run()
+		case <-c.probes:
+		case <-ticker.C:
+			c.logStats()
+		case tag := <-cancelled:
+			return fmt.Errorf("consumer %v cancelled by server", tag)
+		case err := <-connClose:
+			return closeError("connection", err)
+		case err := <-chanClose:
+			return closeError("channel", err)
+		case err := <-repliesClose:
+			return closeError("reply channel", err)
+		case err := <-eventsClose:
+			// Events are best effort, consumer channel is kept
+			c.Logger.Errorf("%v, opening it again", closeError("event channel", err))
+			eventsClose = c.reopenEvents()
+		case err := <-retriesClose:
+			return closeError("retry channel", err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
 
-	forever := make(chan bool)
+func (c *Consumer) shutdown(pool *Pool) {
+	c.state.set(func(s *status) { s.draining = true })
+	c.Logger.Infof("shutting down, waiting for %v jobs and %v confirms ...", c.pending, c.confirming)
+
+	if err := c.Channel.Cancel(c.tag, false); err != nil {
+		c.Logger.Errorf("could not cancel consumer: %v", err)
+	} else {
+		// Deliveries prefetched before the cancel. Unacked ones go back to
+		// the queue, auto acked ones are already ours so we process them.
+		for d := range c.msgs {
+			if c.Cfg.RabbitMq.ManualAck {
+				c.nack(d, true)
+				continue
+			}
+			c.handleDelivery(pool, d)
+		}
+	}
 
-	for d := range msgs {
-		if c.DebugLogger != nil {
-			c.DebugLogger.Printf("received message: %v", string(d.Body))
+	timer := time.NewTimer(time.Duration(c.Cfg.Workers.ShutdownTimeout) * time.Millisecond)
+	defer timer.Stop()
+
+	cancelled := false
+	for c.pending > 0 || c.confirming > 0 {
+		select {
+		case res := <-pool.Results:
+			c.handleResult(res)
+		case <-c.callbacks.ready:
+			c.callbacks.run()
+		case <-c.probes:
+		case <-timer.C:
+			if cancelled {
+				c.Logger.Errorf("%v jobs did not finish and %v confirms were not received after cancel", c.pending, c.confirming)
+				c.close()
+				return
+			}
+
+			// Cancelled jobs report requeue so they end up back in the queue
+			c.Logger.Errorf("shutdown timeout exceeded, cancelling %v unfinished jobs", c.pending)
+			pool.Cancel()
+			cancelled = true
+			timer.Reset(cancelGracePeriod)
 		}
+	}
+
+	pool.Release()
+	c.close()
+	c.logStats()
+	c.Logger.Infof("shutdown complete")
+}
+
+// publish publishes the message with the publisher, done is run by the
+// consumer loop once the message is confirmed.
+func (c *Consumer) publish(p *publisher, exchange string, key string, msg amqp.Publishing, done func(error)) {
+	c.confirming++
+	p.publish(exchange, key, msg, func(err error) {
+		c.confirming--
+		done(err)
+	})
+}
+
+func (c *Consumer) close() {
+	c.state.set(func(s *status) { s.connected = false })
+	if err := c.Channel.Close(); err != nil {
+		c.Logger.Errorf("could not close channel: %v", err)
+	}
+	if err := c.replies.close(); err != nil {
+		c.Logger.Errorf("could not close reply channel: %v", err)
+	}
+	if err := c.events.close(); err != nil {
+		c.Logger.Errorf("could not close event channel: %v", err)
+	}
+	if err := c.retries.close(); err != nil {
+		c.Logger.Errorf("could not close retry channel: %v", err)
+	}
+}
+
+func closeError(kind string, err *amqp.Error) error {
+	if err == nil {
+		return fmt.Errorf("%v closed", kind)
+	}
+	return fmt.Errorf("%v closed: %v", kind, err)
+}
+
+type deliveryJob struct {
+	domain.Job
+	delivery amqp.Delivery
+}
+
+func (dj *deliveryJob) Do(ctx context.Context, logger *logging.Logger) domain.Result {
+	return dj.Job.Do(ctx, logger.With(logging.Fields{
+		"message_id":  dj.delivery.MessageId,
+		"routing_key": dj.delivery.RoutingKey,
+	}))
+}
+
+func (c *Consumer) handleDelivery(pool *Pool, d amqp.Delivery) {
+	metrics.MessagesReceived.Inc()
+	c.stats.received++
+
+	body, err := decompress(d.Body, d.ContentEncoding, c.Cfg.RabbitMq.Compression)
+	if err != nil {
+		metrics.JobBuildFailures.Inc()
+		c.Logger.Errorf("could not decompress message: %v", err)
+		c.rejectMalformed(d)
+		return
+	}
+
+	if c.Logger.Enabled(logging.LevelDebug) {
+		c.Logger.Debugf("received message: %v", string(body))
+	}
+
+	job, err := c.JobBuilder.BuildJob(newMessage(d, body))
+	if err != nil {
+		metrics.JobBuildFailures.Inc()
+		c.Logger.Errorf("could not build job: %v", err)
+		c.rejectMalformed(d)
+		return
+	}
+	metrics.JobsBuilt.Inc()
+
+	dj := &deliveryJob{
+		Job:      job,
+		delivery: d,
+	}
 
-		job, err := c.JobBuilder.BuildJob(d.Body)
-		if err != nil {
-			c.ErrLogger.Printf("could not build job: %v", err)
+	// Keep acknowledging finished jobs while waiting for a free slot in
+	// the job queue, otherwise workers would block on the results channel.
+	for {
+		select {
+		case pool.JobQueue <- dj:
+			metrics.JobQueueDepth.Set(float64(len(pool.JobQueue)), c.Queue)
+			c.pending++
+			return
+		case res := <-pool.Results:
+			c.handleResult(res)
+		case <-c.callbacks.ready:
+			c.callbacks.run()
+		case <-c.probes:
 		}
+	}
+}
+
+func newMessage(d amqp.Delivery, body []byte) *domain.Message {
+	return &domain.Message{
+		Body:          body,
+		Headers:       d.Headers,
+		ContentType:   d.ContentType,
+		Exchange:      d.Exchange,
+		RoutingKey:    d.RoutingKey,
+		MessageID:     d.MessageId,
+		CorrelationID: d.CorrelationId,
+		ReplyTo:       d.ReplyTo,
+		Redelivered:   d.Redelivered,
+		Timestamp:     d.Timestamp,
+		Priority:      d.Priority,
+	}
+}
+
+// Message is malformed, requeueing would not help.
+func (c *Consumer) rejectMalformed(d amqp.Delivery) {
+	if !c.Cfg.RabbitMq.ManualAck {
+		return
+	}
+	c.reject(d, false)
+}
+
+func (c *Consumer) handleResult(res Result) {
+	c.pending--
+
+	if res.Status != domain.StatusSuccess {
+		c.stats.failed++
+		c.Logger.Errorf("job failed, status=%v: %v", res.Status, res.Err)
+	}
+
+	d := res.Job.(*deliveryJob).delivery
+	c.publishEvent(d, res)
+
+	if res.Status == domain.StatusRetry && c.Cfg.Retry.Mode == config.RetryModeQueue {
+		c.retryLater(d, res)
+		return
+	}
 
-		pool.AddJob(job)
+	// Failed reply is only logged, running the job again could repeat calls
+	// which already succeeded.
+	c.reply(d, res, func(error) {
+		c.settle(d, res)
+	})
+}
+
+// settle acknowledges the message according to status of its job.
+func (c *Consumer) settle(d amqp.Delivery, res Result) {
+	if !c.Cfg.RabbitMq.ManualAck {
+		return
+	}
+
+	switch res.Status {
+	case domain.StatusSuccess:
+		c.ack(d)
+	case domain.StatusPermanent:
+		c.handlePermanentFailure(d)
+	case domain.StatusReject:
+		c.reject(d, false)
+	case domain.StatusRequeue:
+		c.nack(d, true)
+	default:
+		c.handleFailure(d)
+	}
+}
+
+// Permanent failures are never requeued, they are either dropped or dead
+// lettered.
+func (c *Consumer) handlePermanentFailure(d amqp.Delivery) {
+	if c.Cfg.RabbitMq.Onfailure == OnFailureAck {
+		c.ack(d)
+		return
+	}
+	c.reject(d, false)
+}
+
+func (c *Consumer) handleFailure(d amqp.Delivery) {
+	switch c.Cfg.RabbitMq.Onfailure {
+	case OnFailureAck:
+		c.ack(d)
+	case OnFailureReject, OnFailureRejectDrop:
+		c.reject(d, false)
+	case OnFailureRejectRequeue:
+		c.reject(d, true)
+	case OnFailureNackDrop:
+		c.nack(d, false)
+	default:
+		c.nack(d, true)
 	}
+}
 
-	pool.WaitAll()
-	<-forever
+// requeuesOnFailure reports whether failed messages go back to the queue.
+func requeuesOnFailure(onfailure int) bool {
+	switch onfailure {
+	case OnFailureRequeue, OnFailureRejectRequeue, OnFailureNackRequeue:
+		return true
+	}
+	return false
 }
 
 func sanitizeQueueArgs(cfg *config.Config) amqp.Table {
+	return queueArgs(cfg.QueueSettings.MessageTTL, cfg.QueueSettings.DeadLetterExchange, cfg.QueueSettings.DeadLetterRoutingKey)
+}
+
+func queueArgs(messageTTL int, deadLetterExchange string, deadLetterRoutingKey string) amqp.Table {
 	args := make(amqp.Table)
 
-	if cfg.QueueSettings.MessageTTL > 0 {
-		args["x-message-ttl"] = int32(cfg.QueueSettings.MessageTTL)
+	if messageTTL > 0 {
+		args["x-message-ttl"] = int32(messageTTL)
 	}
 
-	if cfg.QueueSettings.DeadLetterExchange != "" {
-		args["x-dead-letter-exchange"] = transformToStringValue(cfg.QueueSettings.DeadLetterExchange)
+	if deadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = transformToStringValue(deadLetterExchange)
 
-		if cfg.QueueSettings.DeadLetterRoutingKey != "" {
-			args["x-dead-letter-routing-key"] = transformToStringValue(cfg.QueueSettings.DeadLetterRoutingKey)
+		if deadLetterRoutingKey != "" {
+			args["x-dead-letter-routing-key"] = transformToStringValue(deadLetterRoutingKey)
 		}
 	}
 
@@ -163,3 +698,30 @@ func transformToStringValue(val string) string {
 	}
 	return val
 }
+
+func (c *Consumer) ack(d amqp.Delivery) {
+	if err := d.Ack(false); err != nil {
+		c.Logger.Errorf("could not ack message: %v", err)
+		return
+	}
+	metrics.Acks.Inc()
+	c.stats.acks++
+}
+
+func (c *Consumer) nack(d amqp.Delivery, requeue bool) {
+	if err := d.Nack(false, requeue); err != nil {
+		c.Logger.Errorf("could not nack message: %v", err)
+		return
+	}
+	metrics.Nacks.Inc()
+	c.stats.nacks++
+}
+
+func (c *Consumer) reject(d amqp.Delivery, requeue bool) {
+	if err := d.Reject(requeue); err != nil {
+		c.Logger.Errorf("could not reject message: %v", err)
+		return
+	}
+	metrics.Rejects.Inc()
+	c.stats.rejects++
+}
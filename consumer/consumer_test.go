@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/streadway/amqp"
+)
+
+func TestBindingArgs(t *testing.T) {
+	args, err := bindingArgs([]string{"x-match=any", "format=pdf", "filter=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := amqp.Table{"x-match": "any", "format": "pdf", "filter": "a=b"}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("invalid args, got %v, want %v", args, want)
+	}
+
+	if args, err := bindingArgs(nil); err != nil || args != nil {
+		t.Fatalf("expected nil args, got %v, %v", args, err)
+	}
+
+	for _, pair := range []string{"x-match", "=all"} {
+		if _, err := bindingArgs([]string{pair}); err == nil {
+			t.Fatalf("expected error for %q", pair)
+		}
+	}
+}
+
+// acknowledger records how the delivery was settled.
+type acknowledger struct {
+	ops []string
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.ops = append(a.ops, "ack")
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.ops = append(a.ops, fmt.Sprintf("nack requeue=%v", requeue))
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	a.ops = append(a.ops, fmt.Sprintf("reject requeue=%v", requeue))
+	return nil
+}
+
+func handleResult(onfailure int, status domain.Status) string {
+	cfg := &config.Config{}
+	cfg.RabbitMq.ManualAck = true
+	cfg.RabbitMq.Onfailure = onfailure
+	cfg.Retry.Mode = config.RetryModeWorker
+
+	ack := &acknowledger{}
+	c := &Consumer{Cfg: cfg, Logger: logging.Discard(), pending: 1}
+	c.handleResult(Result{
+		Job:    &deliveryJob{delivery: amqp.Delivery{Acknowledger: ack}},
+		Result: domain.Result{Status: status, Err: errors.New("failed")},
+	})
+	return fmt.Sprint(ack.ops)
+}
+
+func TestHandleResult(t *testing.T) {
+	cases := []struct {
+		onfailure int
+		status    domain.Status
+		want      string
+	}{
+		{onfailure: OnFailureRequeue, status: domain.StatusSuccess, want: "[ack]"},
+		{onfailure: OnFailureRequeue, status: domain.StatusRetry, want: "[nack requeue=true]"},
+		{onfailure: OnFailureAck, status: domain.StatusRetry, want: "[ack]"},
+		{onfailure: OnFailureReject, status: domain.StatusRetry, want: "[reject requeue=false]"},
+		{onfailure: OnFailureRejectDrop, status: domain.StatusRetry, want: "[reject requeue=false]"},
+		{onfailure: OnFailureRejectRequeue, status: domain.StatusRetry, want: "[reject requeue=true]"},
+		{onfailure: OnFailureNackDrop, status: domain.StatusRetry, want: "[nack requeue=false]"},
+		{onfailure: OnFailureNackRequeue, status: domain.StatusRetry, want: "[nack requeue=true]"},
+		{onfailure: OnFailureAck, status: domain.StatusRequeue, want: "[nack requeue=true]"},
+		{onfailure: OnFailureRequeue, status: domain.StatusPermanent, want: "[reject requeue=false]"},
+		{onfailure: OnFailureAck, status: domain.StatusPermanent, want: "[ack]"},
+		{onfailure: OnFailureNackRequeue, status: domain.StatusPermanent, want: "[reject requeue=false]"},
+		{onfailure: OnFailureAck, status: domain.StatusReject, want: "[reject requeue=false]"},
+	}
+
+	for _, cs := range cases {
+		if got := handleResult(cs.onfailure, cs.status); got != cs.want {
+			t.Fatalf("invalid handling of %v with onfailure %v, got %v, want %v", cs.status, cs.onfailure, got, cs.want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
+	"github.com/streadway/amqp"
+)
+
+// event is published to the result exchange once the message is done with.
+type event struct {
+	MessageID     string    `json:"message_id,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Queue         string    `json:"queue"`
+	RoutingKey    string    `json:"routing_key"`
+	Target        string    `json:"target,omitempty"`
+	Status        string    `json:"status"`
+	Code          int       `json:"code,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Attempts      int       `json:"attempts"`
+	DurationMs    int64     `json:"duration_ms"`
+	Body          string    `json:"body,omitempty"`
+	BodyEncoding  string    `json:"body_encoding,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+func newEvent(queue string, d amqp.Delivery, res Result, withBody bool) event {
+	e := event{
+		MessageID:     d.MessageId,
+		CorrelationID: d.CorrelationId,
+		Queue:         queue,
+		RoutingKey:    d.RoutingKey,
+		Target:        res.Target,
+		Status:        res.Status.String(),
+		Code:          res.Code,
+		Attempts:      retryCount(d.Headers) + res.Attempts,
+		DurationMs:    res.Duration.Nanoseconds() / int64(time.Millisecond),
+		Timestamp:     time.Now().UTC(),
+	}
+	if res.Err != nil {
+		e.Error = res.Err.Error()
+	}
+	if withBody && len(res.Body) > 0 {
+		e.Body = string(res.Body)
+		if !utf8.Valid(res.Body) {
+			e.Body = base64.StdEncoding.EncodeToString(res.Body)
+			e.BodyEncoding = "base64"
+		}
+	}
+	return e
+}
+
+// final reports whether the message is done with, it is neither going to
+// be retried nor requeued.
+func (c *Consumer) final(d amqp.Delivery, res Result) bool {
+	if res.Status == domain.StatusRetry && c.Cfg.Retry.Mode == config.RetryModeQueue {
+		return retryCount(d.Headers)+1 >= c.Cfg.Retry.MaxAttempts
+	}
+	if !c.Cfg.RabbitMq.ManualAck {
+		return true
+	}
+
+	switch res.Status {
+	case domain.StatusSuccess, domain.StatusPermanent, domain.StatusReject:
+		return true
+	case domain.StatusRetry:
+		return !requeuesOnFailure(c.Cfg.RabbitMq.Onfailure)
+	}
+	return false
+}
+
+// openEvents opens publisher of events, the exchange is checked up front as
+// publishing to a missing exchange closes the channel.
+func (c *Consumer) openEvents() (*publisher, error) {
+	p, err := c.openPublisher(time.Duration(c.Cfg.Events.ConfirmTimeout) * time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Cfg.Events.Exchange != "" {
+		if err := p.ch.ExchangeDeclarePassive(c.Cfg.Events.Exchange, "direct", false, false, false, false, nil); err != nil {
+			p.close()
+			return nil, fmt.Errorf("could not find event exchange %v: %v", c.Cfg.Events.Exchange, err)
+		}
+	}
+	return p, nil
+}
+
+// reopenEvents replaces closed publisher of events, events are not published
+// until the next reconnect when it fails.
+func (c *Consumer) reopenEvents() chan *amqp.Error {
+	c.events.close()
+
+	p, err := c.openEvents()
+	if err != nil {
+		c.Logger.Errorf("could not open event channel, events are disabled until reconnect: %v", err)
+		c.events = nil
+		return nil
+	}
+	c.events = p
+	return p.notifyClose()
+}
+
+// publishEvent publishes result of the finished job to the result exchange.
+// Failing to do so is only logged, the job itself has already run.
+func (c *Consumer) publishEvent(d amqp.Delivery, res Result) {
+	if c.events == nil || !c.final(d, res) {
+		return
+	}
+
+	body, err := json.Marshal(newEvent(c.Queue, d, res, c.Cfg.Events.Body))
+	if err != nil {
+		c.Logger.Errorf("could not encode result event: %v", err)
+		return
+	}
+
+	msg := amqp.Publishing{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     d.MessageId,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     time.Now(),
+		Body:          body,
+	}
+	c.publish(c.events, c.Cfg.Events.Exchange, c.Cfg.Events.Routingkey, msg, func(err error) {
+		if err != nil {
+			metrics.Events.Inc("failed")
+			c.Logger.Errorf("could not publish result event: %v", err)
+			return
+		}
+		metrics.Events.Inc("published")
+	})
+}
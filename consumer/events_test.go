@@ -0,0 +1,86 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/streadway/amqp"
+)
+
+func TestNewEvent(t *testing.T) {
+	d := amqp.Delivery{
+		MessageId:     "abc",
+		CorrelationId: "corr",
+		RoutingKey:    "orders.created",
+		Headers:       amqp.Table{RetryCountHeader: int32(2)},
+	}
+	res := Result{
+		Result: domain.Result{
+			Status:   domain.StatusPermanent,
+			Err:      errors.New("unexpected http status: 404 Not Found"),
+			Target:   "http://localhost/orders",
+			Attempts: 1,
+			Code:     404,
+			Body:     []byte{0xff, 0xfe},
+		},
+		Duration: time.Millisecond * 1500,
+	}
+
+	e := newEvent("orders", d, res, true)
+	if e.MessageID != "abc" || e.CorrelationID != "corr" || e.Queue != "orders" || e.RoutingKey != "orders.created" {
+		t.Fatalf("invalid message fields, got %+v", e)
+	}
+	if e.Target != "http://localhost/orders" || e.Status != "permanent" || e.Code != 404 || e.Error == "" {
+		t.Fatalf("invalid result fields, got %+v", e)
+	}
+	if e.Attempts != 3 || e.DurationMs != 1500 {
+		t.Fatalf("invalid attempts or duration, got %v %v", e.Attempts, e.DurationMs)
+	}
+	if e.Body != "//4=" || e.BodyEncoding != "base64" {
+		t.Fatalf("invalid body, got %v %v", e.Body, e.BodyEncoding)
+	}
+
+	if e := newEvent("orders", d, res, false); e.Body != "" {
+		t.Fatalf("body should be omitted, got %v", e.Body)
+	}
+}
+
+func TestFinal(t *testing.T) {
+	cases := []struct {
+		mode      string
+		manualAck bool
+		onfailure int
+		retries   int32
+		status    domain.Status
+		want      bool
+	}{
+		{mode: config.RetryModeWorker, manualAck: true, status: domain.StatusSuccess, want: true},
+		{mode: config.RetryModeWorker, manualAck: true, status: domain.StatusPermanent, want: true},
+		{mode: config.RetryModeWorker, manualAck: true, status: domain.StatusRequeue, want: false},
+		{mode: config.RetryModeWorker, manualAck: true, status: domain.StatusRetry, want: false},
+		{mode: config.RetryModeWorker, manualAck: true, onfailure: OnFailureReject, status: domain.StatusRetry, want: true},
+		{mode: config.RetryModeWorker, manualAck: true, onfailure: OnFailureNackRequeue, status: domain.StatusRetry, want: false},
+		{mode: config.RetryModeWorker, manualAck: true, onfailure: OnFailureNackDrop, status: domain.StatusRetry, want: true},
+		{mode: config.RetryModeWorker, manualAck: false, status: domain.StatusRequeue, want: true},
+		{mode: config.RetryModeQueue, manualAck: true, retries: 1, status: domain.StatusRetry, want: false},
+		{mode: config.RetryModeQueue, manualAck: true, retries: 2, status: domain.StatusRetry, want: true},
+	}
+
+	for _, cs := range cases {
+		cfg := &config.Config{}
+		cfg.Retry.Mode = cs.mode
+		cfg.Retry.MaxAttempts = 3
+		cfg.RabbitMq.ManualAck = cs.manualAck
+		cfg.RabbitMq.Onfailure = cs.onfailure
+
+		c := &Consumer{Cfg: cfg}
+		d := amqp.Delivery{Headers: amqp.Table{RetryCountHeader: cs.retries}}
+		res := Result{Result: domain.Result{Status: cs.status}}
+		if got := c.final(d, res); got != cs.want {
+			t.Fatalf("invalid final for %+v, got %v", cs, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Group runs several consumers side by side, usually sharing one Session.
+type Group []*Consumer
+
+// Consume runs all consumers until ctx is cancelled. When one of them
+// fails the others are shut down too and the first error is returned.
+func (g Group) Consume(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(g))
+	for _, c := range g {
+		go func(c *Consumer) {
+			err := c.Consume(ctx)
+			if err != nil {
+				err = fmt.Errorf("queue %v: %v", c.Queue, err)
+				cancel()
+			}
+			errs <- err
+		}(c)
+	}
+
+	var first error
+	for range g {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (g Group) Healthy(timeout time.Duration) error {
+	for _, c := range g {
+		if err := c.Healthy(timeout); err != nil {
+			return fmt.Errorf("queue %v: %v", c.Queue, err)
+		}
+	}
+	return nil
+}
+
+func (g Group) Ready() error {
+	for _, c := range g {
+		if err := c.Ready(); err != nil {
+			return fmt.Errorf("queue %v: %v", c.Queue, err)
+		}
+	}
+	return nil
+}
+
+func (g Group) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeProbe(w, g.Healthy(probeTimeout))
+	})
+}
+
+func (g Group) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeProbe(w, g.Ready())
+	})
+}
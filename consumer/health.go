@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const probeTimeout = time.Second * 5
+
+type status struct {
+	connected bool
+	consuming bool
+	draining  bool
+	pool      *Pool
+}
+
+type state struct {
+	mu sync.RWMutex
+	status
+}
+
+func (s *state) set(fn func(s *status)) {
+	s.mu.Lock()
+	fn(&s.status)
+	s.mu.Unlock()
+}
+
+func (s *state) get() status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+// Healthy reports whether the consumer loop and the pool dispatcher respond.
+func (c *Consumer) Healthy(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case c.probes <- struct{}{}:
+	case <-timer.C:
+		return errors.New("consumer loop not responding")
+	}
+
+	if pool := c.state.get().pool; pool != nil && !pool.Probe(timeout) {
+		return errors.New("dispatcher not responding")
+	}
+	return nil
+}
+
+// Ready reports whether the consumer is connected and receives messages.
+func (c *Consumer) Ready() error {
+	s := c.state.get()
+	switch {
+	case s.draining:
+		return errors.New("draining")
+	case !s.connected:
+		return errors.New("not connected")
+	case !s.consuming:
+		return errors.New("consumer not registered")
+	}
+	return nil
+}
+
+func (c *Consumer) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeProbe(w, c.Healthy(probeTimeout))
+	})
+}
+
+func (c *Consumer) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeProbe(w, c.Ready())
+	})
+}
+
+func writeProbe(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestReady(t *testing.T) {
+	c := &Consumer{}
+
+	cases := []struct {
+		status status
+		ok     bool
+	}{
+		{status: status{}, ok: false},
+		{status: status{connected: true}, ok: false},
+		{status: status{connected: true, consuming: true}, ok: true},
+		{status: status{connected: true, consuming: true, draining: true}, ok: false},
+	}
+
+	for _, cs := range cases {
+		c.state.set(func(s *status) { *s = cs.status })
+
+		rec := httptest.NewRecorder()
+		c.ReadyHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+		want := http.StatusServiceUnavailable
+		if cs.ok {
+			want = http.StatusOK
+		}
+		if rec.Code != want {
+			t.Fatalf("invalid status for %+v, got %v, want %v", cs.status, rec.Code, want)
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	logger := logging.Discard()
+	pool := NewPool("test", 1, 1, logger)
+	defer pool.Release()
+
+	c := &Consumer{probes: make(chan struct{})}
+	c.state.set(func(s *status) { s.pool = pool })
+
+	if err := c.Healthy(time.Millisecond * 10); err == nil {
+		t.Fatal("expected error when consumer loop is not running")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-c.probes:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := c.Healthy(time.Second); err != nil {
+		t.Fatalf("expected healthy, got %v", err)
+	}
+}
+
+func TestGroupReady(t *testing.T) {
+	orders := &Consumer{Queue: "orders"}
+	orders.state.set(func(s *status) { *s = status{connected: true, consuming: true} })
+	audit := &Consumer{Queue: "audit"}
+	audit.state.set(func(s *status) { *s = status{connected: true} })
+
+	g := Group{orders, audit}
+	if err := g.Ready(); err == nil || err.Error() != "queue audit: consumer not registered" {
+		t.Fatalf("invalid ready error, got %v", err)
+	}
+
+	audit.state.set(func(s *status) { s.consuming = true })
+	if err := g.Ready(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,19 +1,28 @@
 package consumer
 
 import (
-	"log"
-	"sync"
+	"context"
+	"time"
 
 	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
 )
 
+type Result struct {
+	Job domain.Job
+	domain.Result
+	Duration time.Duration
+}
+
 type worker struct {
+	ctx        context.Context
 	index      int
 	workerPool chan *worker
 	jobChannel chan domain.Job
+	results    chan Result
 	stop       chan struct{}
-	infLogger  *log.Logger
-	errLogger  *log.Logger
+	logger     *logging.Logger
 }
 
 func (w *worker) start() {
@@ -24,7 +33,17 @@ func (w *worker) start() {
 
 			select {
 			case job = <-w.jobChannel:
-				job.Do(w.index, w.infLogger, w.errLogger)
+				metrics.WorkersBusy.Add(1)
+				metrics.WorkersIdle.Add(-1)
+				start := time.Now()
+
+				res := job.Do(w.ctx, w.logger)
+
+				duration := time.Since(start)
+				metrics.JobDuration.Observe(duration.Seconds(), res.Status.String())
+				metrics.WorkersBusy.Add(-1)
+				metrics.WorkersIdle.Add(1)
+				w.results <- Result{Job: job, Result: res, Duration: duration}
 			case <-w.stop:
 				w.stop <- struct{}{}
 				return
@@ -33,29 +52,42 @@ func (w *worker) start() {
 	}()
 }
 
-func newWorker(index int, pool chan *worker, infLogger *log.Logger, errLogger *log.Logger) *worker {
+func newWorker(ctx context.Context, index int, pool chan *worker, results chan Result, logger *logging.Logger) *worker {
 	return &worker{
+		ctx:        ctx,
 		index:      index,
 		workerPool: pool,
 		jobChannel: make(chan domain.Job),
+		results:    results,
 		stop:       make(chan struct{}),
-		infLogger:  infLogger,
-		errLogger:  errLogger,
+		logger:     logger.With(logging.Fields{"worker": index}),
 	}
 }
 
 type dispatcher struct {
+	queue      string
 	workerPool chan *worker
 	jobQueue   chan domain.Job
 	stop       chan struct{}
+	probes     chan struct{}
 }
 
 func (d *dispatcher) dispatch() {
 	for {
 		select {
 		case job := <-d.jobQueue:
-			worker := <-d.workerPool
+			metrics.JobQueueDepth.Set(float64(len(d.jobQueue)), d.queue)
+
+			// Stay responsive to probes while all workers are busy
+			var worker *worker
+			for worker == nil {
+				select {
+				case worker = <-d.workerPool:
+				case <-d.probes:
+				}
+			}
 			worker.jobChannel <- job
+		case <-d.probes:
 		case <-d.stop:
 			for i := 0; i < cap(d.workerPool); i++ {
 				worker := <-d.workerPool
@@ -63,6 +95,7 @@ func (d *dispatcher) dispatch() {
 				worker.stop <- struct{}{}
 				<-worker.stop
 			}
+			metrics.WorkersIdle.Add(-float64(cap(d.workerPool)))
 
 			d.stop <- struct{}{}
 			return
@@ -70,15 +103,18 @@ func (d *dispatcher) dispatch() {
 	}
 }
 
-func newDispatcher(workerPool chan *worker, jobQueue chan domain.Job, infLogger *log.Logger, errLogger *log.Logger) *dispatcher {
+func newDispatcher(ctx context.Context, queue string, workerPool chan *worker, jobQueue chan domain.Job, results chan Result, logger *logging.Logger) *dispatcher {
 	d := &dispatcher{
+		queue:      queue,
 		workerPool: workerPool,
 		jobQueue:   jobQueue,
 		stop:       make(chan struct{}),
+		probes:     make(chan struct{}),
 	}
 
+	metrics.WorkersIdle.Add(float64(cap(d.workerPool)))
 	for i := 0; i < cap(d.workerPool); i++ {
-		worker := newWorker(i, d.workerPool, infLogger, errLogger)
+		worker := newWorker(ctx, i, d.workerPool, results, logger)
 		worker.start()
 	}
 
@@ -88,16 +124,23 @@ func newDispatcher(workerPool chan *worker, jobQueue chan domain.Job, infLogger
 
 type Pool struct {
 	JobQueue   chan domain.Job
+	Results    chan Result
 	dispatcher *dispatcher
-	wg         sync.WaitGroup
+	cancel     context.CancelFunc
 }
 
-func NewPool(numWorkers int, jobQueueLen int, infLogger *log.Logger, errLogger *log.Logger) *Pool {
+// NewPool creates pool running jobs of the queue, the queue name labels
+// metrics of the pool.
+func NewPool(queue string, numWorkers int, jobQueueLen int, logger *logging.Logger) *Pool {
 	jobQueue := make(chan domain.Job, jobQueueLen)
 	workerPool := make(chan *worker, numWorkers)
+	results := make(chan Result, numWorkers)
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Pool{
 		JobQueue:   jobQueue,
-		dispatcher: newDispatcher(workerPool, jobQueue, infLogger, errLogger),
+		Results:    results,
+		dispatcher: newDispatcher(ctx, queue, workerPool, jobQueue, results, logger),
+		cancel:     cancel,
 	}
 }
 
@@ -105,16 +148,22 @@ func (p *Pool) AddJob(job domain.Job) {
 	p.JobQueue <- job
 }
 
-func (p *Pool) JobDone() {
-	p.wg.Done()
-}
+// Probe reports whether the dispatcher goroutine responds within timeout.
+func (p *Pool) Probe(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-func (p *Pool) WaitCount(count int) {
-	p.wg.Add(count)
+	select {
+	case p.dispatcher.probes <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
-func (p *Pool) WaitAll() {
-	p.wg.Wait()
+// Cancel cancels context of running and queued jobs.
+func (p *Pool) Cancel() {
+	p.cancel()
 }
 
 func (p *Pool) Release() {
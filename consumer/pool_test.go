@@ -0,0 +1,75 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+type testJob struct {
+	res domain.Result
+}
+
+func (j *testJob) Do(ctx context.Context, logger *logging.Logger) domain.Result {
+	return j.res
+}
+
+type blockingJob struct{}
+
+func (j *blockingJob) Do(ctx context.Context, logger *logging.Logger) domain.Result {
+	<-ctx.Done()
+	return domain.Requeue(ctx.Err())
+}
+
+func TestPoolResults(t *testing.T) {
+	logger := logging.Discard()
+	pool := NewPool("test", 2, 4, logger)
+	defer pool.Release()
+
+	jobs := []*testJob{
+		{res: domain.Success([]byte("reply"))},
+		{res: domain.Retry(errors.New("job failed"))},
+		{res: domain.Permanent(errors.New("job failed"))},
+	}
+	for _, job := range jobs {
+		pool.AddJob(job)
+	}
+
+	got := make(map[*testJob]domain.Result)
+	for range jobs {
+		res := <-pool.Results
+		got[res.Job.(*testJob)] = res.Result
+	}
+
+	for _, job := range jobs {
+		res, ok := got[job]
+		if !ok {
+			t.Fatalf("missing result for job %v", job)
+		}
+		if res.Status != job.res.Status || res.Err != job.res.Err {
+			t.Fatalf("invalid result, got %v, want %v", res, job.res)
+		}
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	logger := logging.Discard()
+	pool := NewPool("test", 1, 1, logger)
+	defer pool.Release()
+
+	pool.AddJob(&blockingJob{})
+	pool.Cancel()
+
+	select {
+	case res := <-pool.Results:
+		if res.Status != domain.StatusRequeue {
+			t.Fatalf("invalid status, got %v, want %v", res.Status, domain.StatusRequeue)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job was not cancelled")
+	}
+}
@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// callbacks queues functions to be run by the consumer loop, adding never
+// blocks so that confirms are not held up by a busy consumer loop.
+type callbacks struct {
+	mu    sync.Mutex
+	fns   []func()
+	ready chan struct{}
+}
+
+func newCallbacks() *callbacks {
+	return &callbacks{ready: make(chan struct{}, 1)}
+}
+
+func (cb *callbacks) add(fn func()) {
+	cb.mu.Lock()
+	cb.fns = append(cb.fns, fn)
+	cb.mu.Unlock()
+
+	select {
+	case cb.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (cb *callbacks) run() {
+	cb.mu.Lock()
+	fns := cb.fns
+	cb.fns = nil
+	cb.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+type pendingConfirm struct {
+	tag      uint64
+	deadline time.Time
+	done     func(error)
+}
+
+// publisher publishes messages on its own channel in confirm mode. Confirms
+// are awaited in the background, done callbacks of the messages are run by
+// the consumer loop once the broker confirms them or the timeout passes.
+type publisher struct {
+	ch        *amqp.Channel
+	timeout   time.Duration
+	callbacks *callbacks
+
+	mu      sync.Mutex
+	tag     uint64
+	pending []*pendingConfirm
+}
+
+func newPublisher(ch *amqp.Channel, timeout time.Duration, cb *callbacks) (*publisher, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to put channel into confirm mode: %v", err)
+	}
+
+	p := &publisher{
+		ch:        ch,
+		timeout:   timeout,
+		callbacks: cb,
+	}
+	go p.wait(ch.NotifyPublish(make(chan amqp.Confirmation, 16)))
+	return p, nil
+}
+
+func (p *publisher) publish(exchange string, key string, msg amqp.Publishing, done func(error)) {
+	// Message is pending before it is published so that its confirm is not
+	// handled too early. Lock is not held while publishing, the connection
+	// blocks on delivering confirms until they are settled. Publishing is
+	// done only by the consumer loop, so the tag can be taken back.
+	p.mu.Lock()
+	p.tag++
+	pc := &pendingConfirm{
+		tag:      p.tag,
+		deadline: time.Now().Add(p.timeout),
+		done:     done,
+	}
+	p.pending = append(p.pending, pc)
+	p.mu.Unlock()
+
+	if err := p.ch.Publish(exchange, key, false, false, msg); err != nil {
+		p.mu.Lock()
+		p.tag--
+		p.mu.Unlock()
+		p.settle(func(other *pendingConfirm) bool { return other == pc }, err)
+	}
+}
+
+// wait settles pending messages until the channel is closed.
+func (p *publisher) wait(confirms <-chan amqp.Confirmation) {
+	interval := p.timeout / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case confirm, ok := <-confirms:
+			if !ok {
+				p.settle(func(*pendingConfirm) bool { return true }, errors.New("channel closed before confirm"))
+				return
+			}
+			err := error(nil)
+			if !confirm.Ack {
+				err = errors.New("message nacked by broker")
+			}
+			p.settle(func(pc *pendingConfirm) bool { return pc.tag == confirm.DeliveryTag }, err)
+		case now := <-ticker.C:
+			p.settle(func(pc *pendingConfirm) bool { return now.After(pc.deadline) }, fmt.Errorf("confirm not received within %v", p.timeout))
+		}
+	}
+}
+
+// settle removes pending messages matching fn and queues their callbacks.
+// Confirms of messages which timed out are ignored.
+func (p *publisher) settle(fn func(pc *pendingConfirm) bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending := p.pending[:0]
+	for _, pc := range p.pending {
+		if !fn(pc) {
+			pending = append(pending, pc)
+			continue
+		}
+		done := pc.done
+		p.callbacks.add(func() { done(err) })
+	}
+	p.pending = pending
+}
+
+// notifyClose returns nil channel for nil publisher so that it can be
+// used in select regardless of the configuration.
+func (p *publisher) notifyClose() chan *amqp.Error {
+	if p == nil {
+		return nil
+	}
+	return p.ch.NotifyClose(make(chan *amqp.Error, 1))
+}
+
+func (p *publisher) close() error {
+	if p == nil {
+		return nil
+	}
+	return p.ch.Close()
+}
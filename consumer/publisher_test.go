@@ -0,0 +1,27 @@
+package consumer
+
+import (
+	"testing"
+)
+
+func TestCallbacks(t *testing.T) {
+	cb := newCallbacks()
+
+	var order []int
+	for i := 0; i < 3; i++ {
+		i := i
+		cb.add(func() { order = append(order, i) })
+	}
+
+	<-cb.ready
+	cb.run()
+	if len(order) != 3 || order[0] != 0 || order[2] != 2 {
+		t.Fatalf("invalid callbacks order, got %v", order)
+	}
+
+	select {
+	case <-cb.ready:
+		t.Fatal("ready should be signalled once")
+	default:
+	}
+}
@@ -0,0 +1,120 @@
+package consumer
+
+import (
+	"fmt"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/streadway/amqp"
+)
+
+const (
+	RetryCountHeader = "x-retry-count"
+)
+
+func retryQueueName(queue string, attempt int) string {
+	return fmt.Sprintf("%v.retry.%v", queue, attempt)
+}
+
+// retryQueueTTL returns message TTL in milliseconds of the delay queue for
+// given attempt, doubling Retry.Delay up to Retry.MaxDelay.
+func retryQueueTTL(cfg *config.Config, attempt int) int {
+	ttl := cfg.Retry.Delay
+	for i := 1; i < attempt && (cfg.Retry.MaxDelay <= 0 || ttl < cfg.Retry.MaxDelay); i++ {
+		ttl *= 2
+	}
+	if cfg.Retry.MaxDelay > 0 && ttl > cfg.Retry.MaxDelay {
+		ttl = cfg.Retry.MaxDelay
+	}
+	return ttl
+}
+
+// declareRetryQueues declares one delay queue per retry attempt, expired
+// messages are dead lettered back to the main queue via default exchange.
+func declareRetryQueues(ch *amqp.Channel, cfg *config.Config) error {
+	for attempt := 1; attempt < cfg.Retry.MaxAttempts; attempt++ {
+		name := retryQueueName(cfg.RabbitMq.Queue, attempt)
+		args := queueArgs(retryQueueTTL(cfg, attempt), EmptyString, cfg.RabbitMq.Queue)
+		if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+			return fmt.Errorf("failed to declare retry queue %v: %v", name, err)
+		}
+	}
+
+	if _, err := ch.QueueDeclare(cfg.Retry.ParkingQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare parking queue: %v", err)
+	}
+	return nil
+}
+
+func retryCount(headers amqp.Table) int {
+	switch val := headers[RetryCountHeader].(type) {
+	case int:
+		return val
+	case int8:
+		return int(val)
+	case int16:
+		return int(val)
+	case int32:
+		return int(val)
+	case int64:
+		return int(val)
+	case uint8:
+		return int(val)
+	}
+	return 0
+}
+
+// retryLater republishes failed message to the delay queue of the next
+// attempt or to the parking queue when attempts are exhausted.
+func (c *Consumer) retryLater(d amqp.Delivery, res Result) {
+	attempt := retryCount(d.Headers) + 1
+
+	queue := c.Cfg.Retry.ParkingQueue
+	if attempt < c.Cfg.Retry.MaxAttempts {
+		queue = retryQueueName(c.Queue, attempt)
+	}
+
+	// Message is acked only once the broker confirms it has the copy, the
+	// queues are declared on each connect so the copy is routed.
+	c.publish(c.retries, "", queue, republishing(d, attempt), func(err error) {
+		if err != nil {
+			c.Logger.Errorf("could not publish message to %v: %v", queue, err)
+			if c.Cfg.RabbitMq.ManualAck {
+				c.handleFailure(d)
+			}
+			return
+		}
+		c.Logger.Infof("message moved to %v, attempt=%v", queue, attempt)
+
+		// Parked message is done with, failed reply is only logged as the
+		// message can not be taken back from the parking queue.
+		c.reply(d, res, func(error) {
+			if c.Cfg.RabbitMq.ManualAck {
+				c.ack(d)
+			}
+		})
+	})
+}
+
+func republishing(d amqp.Delivery, attempt int) amqp.Publishing {
+	headers := make(amqp.Table, len(d.Headers)+1)
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[RetryCountHeader] = int32(attempt)
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationId:   d.CorrelationId,
+		ReplyTo:         d.ReplyTo,
+		MessageId:       d.MessageId,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserId:          d.UserId,
+		AppId:           d.AppId,
+		Body:            d.Body,
+	}
+}
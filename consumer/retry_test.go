@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/streadway/amqp"
+)
+
+func TestRetryCount(t *testing.T) {
+	cases := []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{headers: nil, want: 0},
+		{headers: amqp.Table{}, want: 0},
+		{headers: amqp.Table{RetryCountHeader: "3"}, want: 0},
+		{headers: amqp.Table{RetryCountHeader: int32(3)}, want: 3},
+		{headers: amqp.Table{RetryCountHeader: int64(4)}, want: 4},
+		{headers: amqp.Table{RetryCountHeader: uint8(5)}, want: 5},
+	}
+
+	for _, c := range cases {
+		if got := retryCount(c.headers); got != c.want {
+			t.Fatalf("invalid retry count for %v, got %v, want %v", c.headers, got, c.want)
+		}
+	}
+}
+
+func TestRetryQueueTTL(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Retry.Delay = 1000
+	cfg.Retry.MaxDelay = 5000
+
+	cases := []struct {
+		attempt int
+		want    int
+	}{
+		{attempt: 1, want: 1000},
+		{attempt: 2, want: 2000},
+		{attempt: 3, want: 4000},
+		{attempt: 4, want: 5000},
+		{attempt: 10, want: 5000},
+	}
+
+	for _, c := range cases {
+		if got := retryQueueTTL(cfg, c.attempt); got != c.want {
+			t.Fatalf("invalid ttl for attempt %v, got %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestRepublishing(t *testing.T) {
+	d := amqp.Delivery{
+		Headers:       amqp.Table{"x-custom": "value", RetryCountHeader: int32(1)},
+		CorrelationId: "corr",
+		Body:          []byte("body"),
+	}
+
+	msg := republishing(d, 2)
+	if got := retryCount(msg.Headers); got != 2 {
+		t.Fatalf("invalid retry count, got %v, want %v", got, 2)
+	}
+	if msg.Headers["x-custom"] != "value" {
+		t.Fatalf("invalid custom header, got %v", msg.Headers["x-custom"])
+	}
+	if retryCount(d.Headers) != 1 {
+		t.Fatal("original headers modified")
+	}
+	if msg.CorrelationId != d.CorrelationId || string(msg.Body) != string(d.Body) {
+		t.Fatalf("invalid publishing, got %+v", msg)
+	}
+
+	args := queueArgs(1000, EmptyString, "main")
+	want := amqp.Table{
+		"x-message-ttl":             int32(1000),
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": "main",
+	}
+	for k, v := range want {
+		if args[k] != v {
+			t.Fatalf("invalid queue arg %v, got %v, want %v", k, args[k], v)
+		}
+	}
+}
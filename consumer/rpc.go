@@ -0,0 +1,37 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	ReplyStatusHeader = "x-job-status"
+)
+
+// reply publishes result of the job to ReplyTo queue of the request with
+// the same correlation id once the request is done with, failures included.
+// Then is called once the reply is confirmed, right away when there is
+// nothing to reply.
+func (c *Consumer) reply(d amqp.Delivery, res Result, then func(err error)) {
+	// Retried and requeued requests reply once they are done
+	if c.replies == nil || d.ReplyTo == "" || !c.final(d, res) {
+		then(nil)
+		return
+	}
+
+	msg := amqp.Publishing{
+		Headers:       amqp.Table{ReplyStatusHeader: res.Status.String()},
+		ContentType:   res.ReplyContentType,
+		CorrelationId: d.CorrelationId,
+		Timestamp:     time.Now(),
+		Body:          res.Reply,
+	}
+	c.publish(c.replies, "", d.ReplyTo, msg, func(err error) {
+		if err != nil {
+			c.Logger.Errorf("could not publish reply to %v: %v", d.ReplyTo, err)
+		}
+		then(err)
+	})
+}
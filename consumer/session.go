@@ -0,0 +1,120 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/streadway/amqp"
+)
+
+const (
+	heartbeat = time.Second * 10
+	locale    = "en_US"
+)
+
+// Session shares one AMQP connection between consumers, each consumer
+// uses its own channel. Lost connection is dialed again by the first
+// consumer asking for a new channel.
+type Session struct {
+	cfg    *config.Config
+	logger *logging.Logger
+	mu     sync.Mutex
+	conn   *amqp.Connection
+}
+
+func Dial(cfg *config.Config, logger *logging.Logger) (*Session, error) {
+	switch cfg.RabbitMq.UriOrder {
+	case "":
+		cfg.RabbitMq.UriOrder = config.UriOrderSequential
+	case config.UriOrderSequential, config.UriOrderRandom:
+	default:
+		return nil, fmt.Errorf("invalid uri order: %v", cfg.RabbitMq.UriOrder)
+	}
+
+	// All nodes are checked up front, not only when they are dialed
+	for _, uri := range connectionURIs(cfg) {
+		if _, err := dialConfig(uri, cfg); err != nil {
+			return nil, fmt.Errorf("invalid uri %v: %v", redactURI(uri), err)
+		}
+	}
+
+	s := &Session{
+		cfg:    cfg,
+		logger: logger,
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	s.conn = conn
+	return s, nil
+}
+
+// dial tries the nodes one by one until it connects to one of them.
+func (s *Session) dial() (*amqp.Connection, error) {
+	var lastErr error
+	for _, uri := range connectionURIs(s.cfg) {
+		amqpCfg, err := dialConfig(uri, s.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uri %v: %v", redactURI(uri), err)
+		}
+
+		conn, err := amqp.DialConfig(uri, amqpCfg)
+		if nil != err {
+			s.logger.Errorf("could not connect to %v: %v", redactURI(uri), err)
+			lastErr = err
+			continue
+		}
+
+		s.logger.Infof("connected to %v", redactURI(uri))
+		return conn, nil
+	}
+	return nil, fmt.Errorf("failed connecting RabbitMQ: %v", lastErr)
+}
+
+// channel opens a new channel, connection is dialed again when it was
+// closed.
+func (s *Session) channel() (*amqp.Connection, *amqp.Channel, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		ch, err := s.conn.Channel()
+		if err == nil {
+			return s.conn, ch, nil
+		}
+		s.logger.Errorf("could not open channel, dialing again: %v", err)
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch, err := conn.Channel()
+	if nil != err {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to open a channel: %v", err)
+	}
+
+	s.conn = conn
+	return conn, ch, nil
+}
+
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
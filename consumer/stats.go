@@ -0,0 +1,16 @@
+package consumer
+
+// stats counts messages handled by one consumer, it is only touched by the
+// consumer loop.
+type stats struct {
+	received int
+	failed   int
+	acks     int
+	nacks    int
+	rejects  int
+}
+
+func (c *Consumer) logStats() {
+	s := c.stats
+	c.Logger.Infof("stats, received=%v, failed=%v, acks=%v, nacks=%v, rejects=%v, pending=%v", s.received, s.failed, s.acks, s.nacks, s.rejects, c.pending)
+}
@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// externalAuth is SASL EXTERNAL mechanism, the broker authenticates the
+// client by its certificate.
+type externalAuth struct{}
+
+func (auth *externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (auth *externalAuth) Response() string {
+	return ""
+}
+
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName: cfg.Tls.ServerName,
+	}
+
+	if cfg.Tls.MinVersion != "" {
+		version, ok := tlsVersions[cfg.Tls.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls min version: %v", cfg.Tls.MinVersion)
+		}
+		tlsCfg.MinVersion = version
+	}
+
+	if cfg.Tls.CaFile != "" {
+		data, err := ioutil.ReadFile(cfg.Tls.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in ca file %v", cfg.Tls.CaFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.Tls.CertFile != "" || cfg.Tls.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Tls.CertFile, cfg.Tls.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.Tls.External && len(tlsCfg.Certificates) == 0 {
+		return nil, errors.New("external auth requires client certificate")
+	}
+	return tlsCfg, nil
+}
@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+)
+
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "consumer"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	cfg := &config.Config{}
+	cfg.Tls.CaFile = certFile
+	cfg.Tls.CertFile = certFile
+	cfg.Tls.KeyFile = keyFile
+	cfg.Tls.ServerName = "rabbitmq.local"
+	cfg.Tls.MinVersion = "1.2"
+	cfg.Tls.External = true
+
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS12 || tlsCfg.ServerName != "rabbitmq.local" {
+		t.Fatalf("invalid tls config, got %+v", tlsCfg)
+	}
+	if tlsCfg.RootCAs == nil || len(tlsCfg.Certificates) != 1 {
+		t.Fatal("expected ca pool and client certificate")
+	}
+}
+
+func TestNewTLSConfigInvalid(t *testing.T) {
+	cases := []func(cfg *config.Config){
+		func(cfg *config.Config) { cfg.Tls.MinVersion = "2.0" },
+		func(cfg *config.Config) { cfg.Tls.CaFile = "/nonexistent/ca.pem" },
+		func(cfg *config.Config) { cfg.Tls.CertFile = "/nonexistent/cert.pem" },
+		func(cfg *config.Config) { cfg.Tls.External = true },
+	}
+
+	for i, fn := range cases {
+		cfg := &config.Config{}
+		fn(cfg)
+		if _, err := newTLSConfig(cfg); err == nil {
+			t.Fatalf("expected error for case %v", i)
+		}
+	}
+}
+
+func TestExternalAuth(t *testing.T) {
+	auth := &externalAuth{}
+	if auth.Mechanism() != "EXTERNAL" || auth.Response() != "" {
+		t.Fatalf("invalid external auth, got %v %q", auth.Mechanism(), auth.Response())
+	}
+}
@@ -0,0 +1,121 @@
+package consumer
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/streadway/amqp"
+)
+
+// connectionURIs returns URIs of the nodes in the order they should be
+// tried, URI is assembled from the host settings when there are none.
+func connectionURIs(cfg *config.Config) []string {
+	if len(cfg.RabbitMq.Uri) == 0 {
+		scheme := "amqp"
+		if cfg.Tls.Enabled {
+			scheme = "amqps"
+		}
+		return []string{fmt.Sprintf(
+			"%s://%s:%s@%s:%s%s",
+			scheme,
+			url.QueryEscape(cfg.RabbitMq.Username),
+			url.QueryEscape(cfg.RabbitMq.Password),
+			cfg.RabbitMq.Host,
+			cfg.RabbitMq.Port,
+			cfg.RabbitMq.Vhost,
+		)}
+	}
+
+	uris := append([]string{}, cfg.RabbitMq.Uri...)
+	if cfg.RabbitMq.UriOrder == config.UriOrderRandom {
+		rand.Shuffle(len(uris), func(i, j int) {
+			uris[i], uris[j] = uris[j], uris[i]
+		})
+	}
+	return uris
+}
+
+// dialConfig returns connection settings of the URI, query parameters
+// heartbeat (seconds), channel_max, frame_max and connection_timeout
+// (milliseconds) are supported.
+func dialConfig(uri string, cfg *config.Config) (amqp.Config, error) {
+	amqpCfg := amqp.Config{
+		Heartbeat: heartbeat,
+		Locale:    locale,
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return amqpCfg, err
+	}
+
+	// TLS settings would be ignored otherwise
+	if cfg.Tls.Enabled && u.Scheme != "amqps" {
+		return amqpCfg, fmt.Errorf("tls is enabled but scheme is %v, use amqps", u.Scheme)
+	}
+
+	query := u.Query()
+	for key := range query {
+		val, err := strconv.Atoi(query.Get(key))
+		if err != nil {
+			return amqpCfg, fmt.Errorf("invalid %v parameter: %v", key, err)
+		}
+
+		switch key {
+		case "heartbeat":
+			amqpCfg.Heartbeat = time.Duration(val) * time.Second
+		case "channel_max":
+			amqpCfg.ChannelMax = val
+		case "frame_max":
+			amqpCfg.FrameSize = val
+		case "connection_timeout":
+			amqpCfg.Dial = timeoutDialer(time.Duration(val) * time.Millisecond)
+		default:
+			return amqpCfg, fmt.Errorf("unknown parameter: %v", key)
+		}
+	}
+
+	if u.Scheme == "amqps" {
+		tlsCfg, err := newTLSConfig(cfg)
+		if err != nil {
+			return amqpCfg, err
+		}
+		amqpCfg.TLSClientConfig = tlsCfg
+
+		if cfg.Tls.External {
+			amqpCfg.SASL = []amqp.Authentication{&externalAuth{}}
+		}
+	}
+	return amqpCfg, nil
+}
+
+// timeoutDialer is like the default dialer of amqp with custom timeout
+// used for both connecting and handshake.
+func timeoutDialer(timeout time.Duration) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, addr, timeout)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// redactURI hides password of the URI so that it can be logged.
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "<invalid uri>"
+	}
+	u.RawQuery = ""
+	return u.Redacted()
+}
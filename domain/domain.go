@@ -1,13 +1,119 @@
 package domain
 
 import (
-	"log"
+	"context"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+type Status int
+
+const (
+	// StatusSuccess acknowledges the message.
+	StatusSuccess Status = iota
+	// StatusRetry uses the configured failure handling, the message may
+	// succeed when retried later.
+	StatusRetry
+	// StatusRequeue puts the message back to the queue regardless of the
+	// configured failure handling.
+	StatusRequeue
+	// StatusPermanent means the message would fail again, it is never
+	// requeued or retried.
+	StatusPermanent
+	// StatusReject rejects the message without requeue regardless of the
+	// configured failure handling, dead letter exchange takes it.
+	StatusReject
 )
 
+func (s Status) String() string {
+	switch s {
+	case StatusSuccess:
+		return "success"
+	case StatusRetry:
+		return "retry"
+	case StatusRequeue:
+		return "requeue"
+	case StatusPermanent:
+		return "permanent"
+	case StatusReject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+type Result struct {
+	Status Status
+	Err    error
+	Reply  []byte
+	// ReplyContentType is content type of the reply, when known.
+	ReplyContentType string
+
+	// Target is URL or command the job ran, Code its HTTP status or exit
+	// code and Body its raw output. They are reported in result events.
+	Target   string
+	Attempts int
+	Code     int
+	Body     []byte
+}
+
+func Success(reply []byte) Result {
+	return Result{Status: StatusSuccess, Reply: reply}
+}
+
+func Retry(err error) Result {
+	return Result{Status: StatusRetry, Err: err}
+}
+
+func Requeue(err error) Result {
+	return Result{Status: StatusRequeue, Err: err}
+}
+
+func Permanent(err error) Result {
+	return Result{Status: StatusPermanent, Err: err}
+}
+
+func Reject(err error) Result {
+	return Result{Status: StatusReject, Err: err}
+}
+
 type Job interface {
-	Do(worker int, infLogger *log.Logger, errLogger *log.Logger)
+	Do(ctx context.Context, logger *logging.Logger) Result
+}
+
+// Message is the delivery together with its AMQP metadata, Body is already
+// decompressed.
+type Message struct {
+	Body          []byte
+	Headers       map[string]interface{}
+	ContentType   string
+	Exchange      string
+	RoutingKey    string
+	MessageID     string
+	CorrelationID string
+	ReplyTo       string
+	Redelivered   bool
+	Timestamp     time.Time
+	Priority      uint8
 }
 
 type JobBuilder interface {
+	BuildJob(msg *Message) (Job, error)
+}
+
+// BodyJobBuilder is implemented by builders which only need the message body.
+type BodyJobBuilder interface {
 	BuildJob(data []byte) (Job, error)
 }
+
+func AdaptBodyJobBuilder(jb BodyJobBuilder) JobBuilder {
+	return &bodyJobBuilder{jb: jb}
+}
+
+type bodyJobBuilder struct {
+	jb BodyJobBuilder
+}
+
+func (b *bodyJobBuilder) BuildJob(msg *Message) (Job, error) {
+	return b.jb.BuildJob(msg.Body)
+}
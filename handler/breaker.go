@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
+)
+
+// Values of BreakerPolicy.OnOpen, what happens to messages of a host whose
+// circuit is open. Retry is the default, in queue retry mode messages wait
+// in delay queues. Requeued messages are redelivered right away, they are
+// failed again and again until the cooldown passes.
+const (
+	BreakerRequeue = "requeue" // nack with requeue
+	BreakerRetry   = "retry"   // configured failure handling, e.g. delay queue
+	BreakerReject  = "reject"  // permanent failure, dead letter exchange takes it
+)
+
+type BreakerPolicy struct {
+	// Threshold is number of consecutive failures opening the circuit,
+	// zero disables the breaker.
+	Threshold int
+	// Cooldown is how long the circuit stays open before a probe request.
+	Cooldown time.Duration
+	OnOpen   string
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitClosed:
+		return "closed"
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuit struct {
+	state    circuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// breakers keeps one circuit per target host, it is shared by all jobs of
+// a builder.
+type breakers struct {
+	mu       sync.Mutex
+	policy   BreakerPolicy
+	logger   *logging.Logger
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+func newBreakers(policy BreakerPolicy, logger *logging.Logger) *breakers {
+	return &breakers{
+		policy:   policy,
+		logger:   logger,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+func (b *breakers) get(host string) *circuit {
+	host = hostKey(host)
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+	return c
+}
+
+func (b *breakers) transition(host string, c *circuit, state circuitState) {
+	b.logger.With(logging.Fields{"host": host}).Warnf("circuit %v, failures=%v", state, c.failures)
+	c.state = state
+}
+
+// allow reports whether request to the host may be sent. Once the cooldown
+// of open circuit passes, a single probe request is let through.
+func (b *breakers) allow(host string) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(host)
+	switch c.state {
+	case circuitOpen:
+		if b.now().Sub(c.openedAt) < b.policy.Cooldown {
+			return false
+		}
+		b.transition(host, c, circuitHalfOpen)
+		c.probing = true
+		return true
+	case circuitHalfOpen:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	}
+	return true
+}
+
+// record updates the circuit with outcome of the request, host is
+// considered healthy when it responds with non retryable status.
+func (b *breakers) record(host string, ok bool) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.get(host)
+	c.probing = false
+	if ok {
+		c.failures = 0
+		if c.state != circuitClosed {
+			b.transition(host, c, circuitClosed)
+		}
+		return
+	}
+
+	c.failures++
+	if c.state == circuitHalfOpen || (c.state == circuitClosed && c.failures >= b.policy.Threshold) {
+		c.openedAt = b.now()
+		b.transition(host, c, circuitOpen)
+	}
+}
+
+// cancel releases the probe of half open circuit without outcome.
+func (b *breakers) cancel(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.get(host).probing = false
+	b.mu.Unlock()
+}
+
+func (b *breakers) openResult(host string) domain.Result {
+	metrics.CircuitRejections.Inc(metrics.HostLabel(host))
+
+	err := fmt.Errorf("circuit of %v is open", host)
+	switch b.policy.OnOpen {
+	case BreakerRequeue:
+		return domain.Requeue(err)
+	case BreakerReject:
+		return domain.Permanent(err)
+	}
+	return domain.Retry(err)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestBreakerStates(t *testing.T) {
+	now := time.Now()
+	b := newBreakers(BreakerPolicy{Threshold: 2, Cooldown: time.Second}, logging.Discard())
+	b.now = func() time.Time { return now }
+
+	b.record("a", false)
+	if !b.allow("a") {
+		t.Fatal("circuit should stay closed below threshold")
+	}
+	b.record("a", false)
+	if b.allow("a") {
+		t.Fatal("circuit should be open")
+	}
+	if !b.allow("b") {
+		t.Fatal("circuits of other hosts should not be affected")
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow("a") {
+		t.Fatal("probe should be allowed after cooldown")
+	}
+	if b.allow("a") {
+		t.Fatal("only one probe should be allowed")
+	}
+	b.record("a", false)
+	if b.allow("a") {
+		t.Fatal("failed probe should open the circuit")
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow("a") {
+		t.Fatal("probe should be allowed after cooldown")
+	}
+	b.cancel("a")
+	if !b.allow("a") {
+		t.Fatal("cancelled probe should be released")
+	}
+	b.record("a", true)
+	if !b.allow("a") || !b.allow("a") {
+		t.Fatal("successful probe should close the circuit")
+	}
+}
+
+func TestBreakerHostCase(t *testing.T) {
+	b := newBreakers(BreakerPolicy{Threshold: 1, Cooldown: time.Second}, logging.Discard())
+
+	b.record("Example.com", false)
+	if b.allow("example.com") {
+		t.Fatal("circuit should not depend on case of host")
+	}
+}
+
+func TestBreakerOpenResult(t *testing.T) {
+	cases := map[string]domain.Status{
+		"":             domain.StatusRetry,
+		BreakerRequeue: domain.StatusRequeue,
+		BreakerRetry:   domain.StatusRetry,
+		BreakerReject:  domain.StatusPermanent,
+	}
+	for onOpen, want := range cases {
+		b := newBreakers(BreakerPolicy{Threshold: 1, OnOpen: onOpen}, logging.Discard())
+		if res := b.openResult("a"); res.Status != want {
+			t.Fatalf("invalid status for %q, got %v, want %v", onOpen, res.Status, want)
+		}
+	}
+}
+
+func TestHTTPJobBreaker(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout: time.Second,
+		Retry:   RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond},
+		Breaker: BreakerPolicy{Threshold: 2},
+	}, logger)
+
+	job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := job.Do(context.Background(), logger)
+	if res.Status != domain.StatusRetry || res.Attempts != 2 || calls != 2 {
+		t.Fatalf("expected retry after 2 calls, got %v, attempts=%v, calls=%v", res.Status, res.Attempts, calls)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if jb.breakers.allow(u.Host) {
+		t.Fatal("circuit should be open")
+	}
+}
+
+func TestHTTPJobBreakerBeforeLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout: time.Second,
+		Breaker: BreakerPolicy{Threshold: 1, Cooldown: time.Hour},
+		Limits:  LimitOptions{Host: LimitPolicy{MaxInFlight: 1}, OnLimit: LimitRequeue},
+	}, logger)
+
+	u := mustParseURL(srv.URL)
+	release, err := jb.limits.acquire(context.Background(), u, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// Open circuit is reported without waiting for the limit
+	jb.breakers.record(u.Host, false)
+	job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := job.Do(context.Background(), logger); res.Status != domain.StatusRetry {
+		t.Fatalf("expected retry, got %v", res.Status)
+	}
+
+	// Probe is given back when the limit is reached
+	jb.breakers.policy.Cooldown = 0
+	if res := job.Do(context.Background(), logger); res.Status != domain.StatusRequeue {
+		t.Fatalf("expected requeue, got %v", res.Status)
+	}
+	if !jb.breakers.allow(u.Host) {
+		t.Fatal("probe should be released")
+	}
+}
@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+const (
+	ExecInputStdin    = "stdin"
+	ExecInputArgument = "argument"
+)
+
+// Exit codes of the executed command, compatible with the original
+// rabbitmq-cli-consumer, they take precedence over the configured failure
+// handling. Other non zero codes use the configured failure handling.
+const (
+	ExitAck           = 0
+	ExitReject        = 3
+	ExitRejectRequeue = 4
+	ExitNack          = 5
+	ExitNackRequeue   = 6
+)
+
+// execWaitDelay bounds waiting for output of processes which left the
+// process group of the killed command.
+const execWaitDelay = time.Second
+
+func init() {
+	Register("exec", newExecJobBuilderFromConfig)
+}
+
+type ExecOptions struct {
+	Command string
+	Args    []string
+	Input   string
+	Base64  bool
+	Timeout time.Duration
+	Env     []string
+}
+
+type ExecJob struct {
+	opts ExecOptions
+	body []byte
+	env  []string
+}
+
+func (ej *ExecJob) Do(ctx context.Context, logger *logging.Logger) domain.Result {
+	res := ej.run(ctx, logger.With(logging.Fields{"command": ej.opts.Command}))
+	res.Target = ej.opts.Command
+	res.Attempts = 1
+	return res
+}
+
+func (ej *ExecJob) run(ctx context.Context, logger *logging.Logger) domain.Result {
+	parent := ctx
+	if ej.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ej.opts.Timeout)
+		defer cancel()
+	}
+
+	payload := ej.body
+	if ej.opts.Base64 {
+		payload = []byte(base64.StdEncoding.EncodeToString(ej.body))
+	}
+
+	args := ej.opts.Args
+	if ej.opts.Input == ExecInputArgument {
+		args = append(append([]string{}, args...), string(payload))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ej.opts.Command, args...)
+	cmd.Env = append(append(os.Environ(), ej.opts.Env...), ej.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	cmd.WaitDelay = execWaitDelay
+	if ej.opts.Input == ExecInputStdin {
+		cmd.Stdin = bytes.NewReader(payload)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	if out := strings.TrimSpace(stdout.String()); out != "" {
+		logger.Infof("command output: %v", out)
+	}
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		logger.Warnf("command error output: %v", out)
+	}
+
+	if parent.Err() != nil {
+		return domain.Requeue(fmt.Errorf("command cancelled: %v", parent.Err()))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return domain.Retry(fmt.Errorf("command timed out after %v", ej.opts.Timeout))
+	}
+
+	code := ExitAck
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return domain.Retry(fmt.Errorf("could not run command: %v", err))
+		}
+		code = exitErr.ExitCode()
+	}
+	logger.With(logging.Fields{
+		"exit":        code,
+		"duration_ms": time.Since(start).Nanoseconds() / int64(time.Millisecond),
+	}).Infof("command executed")
+
+	res := exitCodeResult(code)
+	if res.Status == domain.StatusSuccess {
+		res.Reply = stdout.Bytes()
+	}
+	res.Code = code
+	res.Body = stdout.Bytes()
+	return res
+}
+
+func exitCodeResult(code int) domain.Result {
+	err := fmt.Errorf("command failed with exit code %v", code)
+	switch code {
+	case ExitAck:
+		return domain.Success(nil)
+	case ExitReject, ExitNack:
+		return domain.Reject(err)
+	case ExitRejectRequeue, ExitNackRequeue:
+		return domain.Requeue(err)
+	}
+	return domain.Retry(err)
+}
+
+func NewExecJobBuilder(opts ExecOptions, logger *logging.Logger) (*ExecJobBuilder, error) {
+	if opts.Command == "" {
+		return nil, errors.New("empty command")
+	}
+	switch opts.Input {
+	case "":
+		opts.Input = ExecInputStdin
+	case ExecInputStdin, ExecInputArgument:
+	default:
+		return nil, fmt.Errorf("invalid command input: %v", opts.Input)
+	}
+	return &ExecJobBuilder{
+		opts:   opts,
+		logger: logger,
+	}, nil
+}
+
+func newExecJobBuilderFromConfig(cfg *config.Config, state *State, logger *logging.Logger) (domain.JobBuilder, error) {
+	return NewExecJobBuilder(ExecOptions{
+		Command: cfg.Exec.Command,
+		Args:    cfg.Exec.Arg,
+		Input:   cfg.Exec.Input,
+		Base64:  cfg.Exec.Base64,
+		Timeout: time.Duration(cfg.Exec.Timeout) * time.Millisecond,
+		Env:     cfg.Exec.Env,
+	}, logger)
+}
+
+type ExecJobBuilder struct {
+	opts   ExecOptions
+	logger *logging.Logger
+}
+
+func (e *ExecJobBuilder) BuildJob(m *domain.Message) (domain.Job, error) {
+	body := make([]byte, len(m.Body))
+	copy(body, m.Body)
+
+	return &ExecJob{
+		opts: e.opts,
+		body: body,
+		env:  messageEnv(m),
+	}, nil
+}
+
+var envReplacer = strings.NewReplacer("-", "_", ".", "_", " ", "_")
+
+// messageEnv exposes AMQP properties and headers of the message to the
+// command as AMQP_* environment variables.
+func messageEnv(m *domain.Message) []string {
+	var env []string
+	set := func(key string, val string) {
+		if val != "" {
+			env = append(env, "AMQP_"+key+"="+val)
+		}
+	}
+
+	set("CONTENT_TYPE", m.ContentType)
+	set("EXCHANGE", m.Exchange)
+	set("ROUTING_KEY", m.RoutingKey)
+	set("MESSAGE_ID", m.MessageID)
+	set("CORRELATION_ID", m.CorrelationID)
+	set("REPLY_TO", m.ReplyTo)
+	set("REDELIVERED", strconv.FormatBool(m.Redelivered))
+	set("PRIORITY", strconv.Itoa(int(m.Priority)))
+	if !m.Timestamp.IsZero() {
+		set("TIMESTAMP", strconv.FormatInt(m.Timestamp.Unix(), 10))
+	}
+
+	for k, v := range m.Headers {
+		switch v.(type) {
+		case string, bool, int8, int16, int32, int64, uint8, float32, float64:
+			set("HEADER_"+strings.ToUpper(envReplacer.Replace(k)), fmt.Sprint(v))
+		}
+	}
+	sort.Strings(env)
+	return env
+}
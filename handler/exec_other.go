@@ -0,0 +1,9 @@
+//go:build windows
+
+package handler
+
+import "os/exec"
+
+// setProcessGroup keeps the default cancellation, only the command itself
+// is killed.
+func setProcessGroup(cmd *exec.Cmd) {}
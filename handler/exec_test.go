@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func runExec(t *testing.T, opts ExecOptions, body string) (string, domain.Result) {
+	var out bytes.Buffer
+	logger, err := logging.New(logging.Options{Out: &out, ErrOut: ioutil.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jb, err := NewExecJobBuilder(opts, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := jb.BuildJob(&domain.Message{Body: []byte(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := job.Do(context.Background(), logger)
+	return out.String(), res
+}
+
+func TestExecInput(t *testing.T) {
+	cases := []struct {
+		opts ExecOptions
+		want string
+	}{
+		{
+			opts: ExecOptions{Command: "/bin/sh", Args: []string{"-c", "cat"}},
+			want: "INFO command output: hello",
+		},
+		{
+			opts: ExecOptions{Command: "/bin/sh", Args: []string{"-c", "cat"}, Base64: true},
+			want: "INFO command output: aGVsbG8=",
+		},
+		{
+			opts: ExecOptions{Command: "/bin/sh", Args: []string{"-c", `echo "$1"`, "sh"}, Input: ExecInputArgument},
+			want: "INFO command output: hello",
+		},
+		{
+			opts: ExecOptions{Command: "/bin/sh", Args: []string{"-c", `echo "$GREETING"`}, Env: []string{"GREETING=hi"}},
+			want: "INFO command output: hi",
+		},
+	}
+
+	for _, c := range cases {
+		out, res := runExec(t, c.opts, "hello")
+		if res.Status != domain.StatusSuccess {
+			t.Fatal(res.Err)
+		}
+		if !strings.Contains(out, c.want) {
+			t.Fatalf("invalid output, got %q, want %q", out, c.want)
+		}
+	}
+}
+
+func TestExecExitCodes(t *testing.T) {
+	cases := []struct {
+		code string
+		want domain.Status
+	}{
+		{code: "0", want: domain.StatusSuccess},
+		{code: "1", want: domain.StatusRetry},
+		{code: "3", want: domain.StatusReject},
+		{code: "4", want: domain.StatusRequeue},
+		{code: "5", want: domain.StatusReject},
+		{code: "6", want: domain.StatusRequeue},
+	}
+
+	for _, c := range cases {
+		_, res := runExec(t, ExecOptions{Command: "/bin/sh", Args: []string{"-c", "exit " + c.code}}, "")
+		if res.Status != c.want {
+			t.Fatalf("invalid status for exit %v, got %v, want %v", c.code, res.Status, c.want)
+		}
+	}
+}
+
+func TestExecTimeout(t *testing.T) {
+	opts := ExecOptions{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "exec sleep 5"},
+		Timeout: time.Millisecond * 50,
+	}
+
+	_, res := runExec(t, opts, "")
+	if res.Status != domain.StatusRetry || !strings.Contains(res.Err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", res.Err)
+	}
+}
+
+func TestExecTimeoutSubprocess(t *testing.T) {
+	opts := ExecOptions{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 3; echo done"},
+		Timeout: time.Millisecond * 200,
+	}
+
+	start := time.Now()
+	_, res := runExec(t, opts, "")
+	if res.Status != domain.StatusRetry || !strings.Contains(res.Err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", res.Err)
+	}
+	if d := time.Since(start); d > time.Second*2 {
+		t.Fatalf("command should be killed with its subprocesses, took %v", d)
+	}
+}
+
+func TestNewExecJobBuilderInvalid(t *testing.T) {
+	logger := logging.Discard()
+	if _, err := NewExecJobBuilder(ExecOptions{}, logger); err == nil {
+		t.Fatal("expected error for empty command")
+	}
+	if _, err := NewExecJobBuilder(ExecOptions{Command: "true", Input: "file"}, logger); err == nil {
+		t.Fatal("expected error for invalid input")
+	}
+}
+
+func TestMessageEnv(t *testing.T) {
+	msg := &domain.Message{
+		Headers:     map[string]interface{}{"x-tenant": "acme"},
+		RoutingKey:  "order.created",
+		MessageID:   "msg-1",
+		Redelivered: false,
+		Timestamp:   time.Unix(1514808000, 0),
+	}
+
+	got := messageEnv(msg)
+	want := []string{
+		"AMQP_HEADER_X_TENANT=acme",
+		"AMQP_MESSAGE_ID=msg-1",
+		"AMQP_PRIORITY=0",
+		"AMQP_REDELIVERED=false",
+		"AMQP_ROUTING_KEY=order.created",
+		"AMQP_TIMESTAMP=1514808000",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid env, got %v, want %v", got, want)
+	}
+}
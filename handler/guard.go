@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
+)
+
+var DefaultSchemes = []string{"http", "https"}
+
+// Address ranges blocked in addition to loopback, private, link-local and
+// unspecified addresses. NAT64 and 6to4 ranges embed IPv4 addresses which
+// may be private.
+var blockedNetworks = mustParseNetworks(
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+	"2002::/16",
+)
+
+// blockedError means the destination is not allowed, sending the request
+// again would not help.
+type blockedError struct {
+	reason string
+}
+
+func (e *blockedError) Error() string {
+	return "destination not allowed: " + e.reason
+}
+
+func blocked(stage string, format string, args ...interface{}) error {
+	metrics.BlockedRequests.Inc(stage)
+	return &blockedError{reason: fmt.Sprintf(format, args...)}
+}
+
+func isBlocked(err error) bool {
+	var b *blockedError
+	return errors.As(err, &b)
+}
+
+type GuardOptions struct {
+	Schemes []string
+	// Hosts are allowed host names, *.example.com allows subdomains.
+	Hosts []string
+	// Networks are allowed address ranges, they are allowed even when
+	// private.
+	Networks []string
+	// Paths are allowed path prefixes.
+	Paths        []string
+	AllowPrivate bool
+}
+
+// Guard checks destination of requests, URL is checked when the job is
+// built and resolved address when connecting.
+type Guard struct {
+	opts     GuardOptions
+	networks []*net.IPNet
+}
+
+func NewGuard(opts GuardOptions) (*Guard, error) {
+	if len(opts.Schemes) == 0 {
+		opts.Schemes = DefaultSchemes
+	}
+
+	networks, err := parseNetworks(opts.Networks...)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{opts: opts, networks: networks}, nil
+}
+
+func parseNetworks(vals ...string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(vals))
+	for _, val := range vals {
+		if !strings.Contains(val, "/") {
+			ip := net.ParseIP(val)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network: %v", val)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %v", val)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func mustParseNetworks(vals ...string) []*net.IPNet {
+	networks, err := parseNetworks(vals...)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || contains(blockedNetworks, ip)
+}
+
+func (g *Guard) restrictsHosts() bool {
+	return len(g.opts.Hosts) > 0 || len(g.networks) > 0
+}
+
+func (g *Guard) matchHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range g.opts.Hosts {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// checkURL checks scheme, host and path of the URL. Hosts not allowed by
+// name are checked against allowed networks once resolved.
+func (g *Guard) checkURL(u *url.URL) error {
+	if g == nil {
+		return nil
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !containsString(g.opts.Schemes, scheme) {
+		return blocked("url", "scheme %v is not allowed", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return blocked("url", "empty host")
+	}
+	if g.restrictsHosts() && !g.matchHost(host) && len(g.networks) == 0 {
+		return blocked("url", "host %v is not allowed", host)
+	}
+
+	if len(g.opts.Paths) > 0 {
+		p := path.Clean("/" + u.Path)
+		if strings.HasSuffix(u.Path, "/") && p != "/" {
+			p += "/"
+		}
+		allowed := false
+		for _, prefix := range g.opts.Paths {
+			if strings.HasPrefix(p, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return blocked("url", "path %v is not allowed", p)
+		}
+	}
+	return nil
+}
+
+// checkIP checks address the host resolved to.
+func (g *Guard) checkIP(host string, ip net.IP) error {
+	if contains(g.networks, ip) {
+		return nil
+	}
+	if g.restrictsHosts() && !g.matchHost(host) {
+		return blocked("dial", "address %v of %v is not in allowed networks", ip, host)
+	}
+	if !g.opts.AllowPrivate && isPrivate(ip) {
+		return blocked("dial", "address %v of %v is private", ip, host)
+	}
+	return nil
+}
+
+// dialContext resolves the host and connects only to allowed addresses, the
+// checked address is dialed directly so DNS can not change in between.
+func (g *Guard) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		lastErr := fmt.Errorf("no addresses found for %v", host)
+		for _, a := range addrs {
+			if err := g.checkIP(host, a.IP); err != nil {
+				lastErr = err
+				continue
+			}
+
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(a.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// checkRedirect applies the checks to redirect targets too.
+func (g *Guard) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return g.checkURL(req.URL)
+}
+
+func containsString(vals []string, val string) bool {
+	for _, v := range vals {
+		if strings.EqualFold(v, val) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestGuardCheckURL(t *testing.T) {
+	g, err := NewGuard(GuardOptions{
+		Hosts: []string{"api.example.com", "*.hooks.example.com"},
+		Paths: []string{"/v1/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"https://api.example.com/v1/orders":        true,
+		"http://API.example.com/v1/orders":         true,
+		"https://a.hooks.example.com/v1/":          true,
+		"https://hooks.example.com/v1/":            false,
+		"https://api.example.com/v2/orders":        false,
+		"https://api.example.com/v1/../v2/orders":  false,
+		"ftp://api.example.com/v1/orders":          false,
+		"https://other.example.com/v1/orders":      false,
+		"https://api.example.com.evil.com/v1/test": false,
+	}
+	for uri, want := range cases {
+		u, _ := url.Parse(uri)
+		err := g.checkURL(u)
+		if got := err == nil; got != want {
+			t.Fatalf("invalid check for %v, got %v, want %v", uri, err, want)
+		}
+		if err != nil && !isBlocked(err) {
+			t.Fatalf("expected blocked error for %v, got %v", uri, err)
+		}
+	}
+}
+
+func TestGuardCheckIP(t *testing.T) {
+	g, err := NewGuard(GuardOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"192.168.0.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"192.0.0.8":       false,
+		"198.18.0.1":      false,
+		"240.0.0.1":       false,
+		"255.255.255.255": false,
+		"64:ff9b::a00:1":  false,
+		"2002:a00:1::1":   false,
+	}
+	for ip, want := range cases {
+		if got := g.checkIP("example.com", net.ParseIP(ip)) == nil; got != want {
+			t.Fatalf("invalid check for %v, got %v, want %v", ip, got, want)
+		}
+	}
+
+	g, err = NewGuard(GuardOptions{Networks: []string{"10.0.0.0/8", "192.168.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.checkIP("internal", net.ParseIP("10.1.2.3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.checkIP("internal", net.ParseIP("192.168.0.1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.checkIP("internal", net.ParseIP("93.184.216.34")); err == nil {
+		t.Fatal("expected error for address outside of allowed networks")
+	}
+}
+
+func TestNewGuardInvalid(t *testing.T) {
+	if _, err := NewGuard(GuardOptions{Networks: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("expected error for invalid network")
+	}
+	if _, err := NewGuard(GuardOptions{Networks: []string{"localhost"}}); err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+}
+
+func TestHTTPJobGuard(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/private", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		opts GuardOptions
+		path string
+		want domain.Status
+	}{
+		{opts: GuardOptions{}, want: domain.StatusPermanent},
+		{opts: GuardOptions{AllowPrivate: true}, want: domain.StatusSuccess},
+		{opts: GuardOptions{Networks: []string{"127.0.0.0/8"}}, want: domain.StatusSuccess},
+		{opts: GuardOptions{Networks: []string{"127.0.0.0/8"}, Paths: []string{"/redirect"}}, path: "/redirect", want: domain.StatusPermanent},
+	}
+
+	logger := logging.Discard()
+	for _, c := range cases {
+		g, err := NewGuard(c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jb := NewHTTPJobBuilder(HTTPOptions{Timeout: time.Second, Guard: g}, logger)
+		job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL + c.path)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := job.Do(context.Background(), logger); res.Status != c.want {
+			t.Fatalf("invalid status for %+v, got %v (%v), want %v", c.opts, res.Status, res.Err, c.want)
+		}
+	}
+
+	g, _ := NewGuard(GuardOptions{Schemes: []string{"https"}})
+	jb := NewHTTPJobBuilder(HTTPOptions{Timeout: time.Second, Guard: g}, logger)
+	if _, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)}); !isBlocked(err) {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+}
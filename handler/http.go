@@ -2,67 +2,411 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/jbub/rabbitmq-cli-consumer/config"
 	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
 )
 
+func init() {
+	Register("http", newHTTPJobBuilderFromConfig)
+}
+
 type HTTPJob struct {
-	client *http.Client
-	req    *http.Request
+	client       *http.Client
+	req          *http.Request
+	retry        RetryPolicy
+	status       StatusPolicy
+	reply        bool
+	replyHeaders []string
+	breakers     *breakers
+	limits       *limits
+}
+
+// Response bodies up to this size are kept as job reply.
+const maxReplySize = 1 << 20
+
+func (hj *HTTPJob) Do(ctx context.Context, logger *logging.Logger) domain.Result {
+	logger = logger.With(logging.Fields{
+		"method": hj.req.Method,
+		"url":    hj.req.URL.String(),
+	})
+
+	var (
+		attempt int
+		code    int
+		body    []byte
+	)
+	done := func(res domain.Result) domain.Result {
+		res.Target = hj.req.URL.String()
+		res.Attempts = attempt
+		res.Code = code
+		res.Body = body
+		return res
+	}
+
+	host := hostKey(hj.req.URL.Host)
+	for attempt = 1; ; attempt++ {
+		// Open circuit is checked first so that its messages do not take
+		// or wait for slots of the limit.
+		if !hj.breakers.allow(host) {
+			attempt--
+			return done(hj.breakers.openResult(host))
+		}
+
+		release, err := hj.limits.acquire(ctx, hj.req.URL, logger)
+		if err != nil {
+			// No request was sent in this attempt
+			hj.breakers.cancel(host)
+			attempt--
+			if err == errLimited {
+				return done(hj.limits.limitedResult(host))
+			}
+			return done(domain.Requeue(fmt.Errorf("http request cancelled: %v", err)))
+		}
+
+		code, body = 0, nil
+		start := time.Now()
+		resp, err := hj.send(ctx)
+		if err == nil {
+			metrics.HTTPRequests.Inc(metrics.HostLabel(host), metrics.StatusClass(resp.StatusCode))
+			reply, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxReplySize))
+			resp.Body.Close()
+			release()
+			code, body = resp.StatusCode, reply
+			logger.With(logging.Fields{
+				"status":      resp.StatusCode,
+				"duration_ms": time.Since(start).Nanoseconds() / int64(time.Millisecond),
+				"attempt":     attempt,
+			}).Infof("request sent")
+
+			class := hj.status.classify(resp.StatusCode)
+			hj.breakers.record(host, class != statusRetry)
+
+			switch class {
+			case statusSuccess:
+				return done(hj.withReply(domain.Success(reply), resp, reply))
+			case statusPermanent:
+				return done(hj.withReply(domain.Permanent(fmt.Errorf("unexpected http status: %v", resp.Status)), resp, reply))
+			}
+			err = fmt.Errorf("retryable http status: %v", resp.Status)
+		} else {
+			release()
+			metrics.HTTPRequests.Inc(metrics.HostLabel(host), "error")
+			if ctx.Err() != nil {
+				hj.breakers.cancel(host)
+				return done(domain.Requeue(fmt.Errorf("http request cancelled: %v", ctx.Err())))
+			}
+			if isBlocked(err) {
+				hj.breakers.cancel(host)
+				return done(domain.Permanent(err))
+			}
+			hj.breakers.record(host, false)
+			err = fmt.Errorf("could not perform http request: %v", err)
+		}
+
+		if attempt >= hj.retry.MaxAttempts {
+			return done(domain.Retry(err))
+		}
+
+		delay := hj.retry.delay(attempt, resp)
+		logger.With(logging.Fields{"attempt": attempt}).Warnf("retrying request in %v: %v", delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return done(domain.Requeue(fmt.Errorf("http request cancelled: %v", ctx.Err())))
+		}
+	}
+}
+
+// withReply replaces the reply by JSON envelope of the response in RPC mode.
+func (hj *HTTPJob) withReply(res domain.Result, resp *http.Response, body []byte) domain.Result {
+	if !hj.reply {
+		return res
+	}
+
+	reply := httpReply{
+		Status: resp.StatusCode,
+		Body:   string(body),
+	}
+	if !utf8.Valid(body) {
+		reply.Body = base64.StdEncoding.EncodeToString(body)
+		reply.Encoding = "base64"
+	}
+	for _, name := range hj.replyHeaders {
+		if val := resp.Header.Get(name); val != "" {
+			if reply.Headers == nil {
+				reply.Headers = make(map[string]string)
+			}
+			reply.Headers[http.CanonicalHeaderKey(name)] = val
+		}
+	}
+
+	data, _ := json.Marshal(reply)
+	res.Reply = data
+	res.ReplyContentType = "application/json"
+	return res
+}
+
+type httpReply struct {
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     string            `json:"body"`
+	Encoding string            `json:"encoding,omitempty"`
 }
 
-func (hj *HTTPJob) Do(worker int, infLogger *log.Logger, errLogger *log.Logger) {
-	resp, err := hj.client.Do(hj.req)
+func (hj *HTTPJob) send(ctx context.Context) (*http.Response, error) {
+	req := hj.req.WithContext(ctx)
+
+	// Body is consumed by every attempt
+	if hj.req.GetBody != nil {
+		body, err := hj.req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return hj.client.Do(req)
+}
+
+type HTTPOptions struct {
+	Timeout         time.Duration
+	Retry           RetryPolicy
+	Status          StatusPolicy
+	ForwardMetadata bool
+	// Reply wraps responses into JSON envelope published as RPC reply.
+	Reply        bool
+	ReplyHeaders []string
+	Breaker      BreakerPolicy
+	Limits       LimitOptions
+	// Guard checks destinations of requests, nil allows any destination.
+	Guard *Guard
+}
+
+func NewHTTPJobBuilder(opts HTTPOptions, logger *logging.Logger) *HTTPJobBuilder {
+	jb := newHTTPJobBuilder(opts, logger)
+	jb.breakers = newBreakersOf(jb.opts.Breaker, logger)
+	jb.limits = newLimitsOf(jb.opts.Limits, logger)
+	return jb
+}
+
+// State holds circuits and limits shared by job builders of all consumers,
+// limits of a target apply to the whole process.
+type State struct {
+	breakers *breakers
+	limits   *limits
+}
+
+// NewState creates the shared state from the main sections of the
+// configuration, it is meant to be created once and passed to New.
+func NewState(cfg *config.Config, logger *logging.Logger) (*State, error) {
+	opts, err := httpOptionsFromConfig(cfg)
 	if err != nil {
-		errLogger.Printf("could not perform http request: %v", err)
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
+	return &State{
+		breakers: newBreakersOf(opts.Breaker, logger),
+		limits:   newLimitsOf(opts.Limits, logger),
+	}, nil
+}
 
-	infLogger.Printf("request sent, worker=%v, method=%v, url=%v, status=%v", worker, hj.req.Method, hj.req.URL.String(), resp.Status)
+func newBreakersOf(policy BreakerPolicy, logger *logging.Logger) *breakers {
+	if policy.Threshold <= 0 {
+		return nil
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = time.Second * 30
+	}
+	return newBreakers(policy, logger)
 }
 
-func NewHTTPJobBuilder(timeout time.Duration, infLogger *log.Logger) *HTTPJobBuilder {
+func newLimitsOf(opts LimitOptions, logger *logging.Logger) *limits {
+	if !opts.Host.enabled() && len(opts.Prefix) == 0 {
+		return nil
+	}
+	return newLimits(opts, logger)
+}
+
+func newHTTPJobBuilder(opts HTTPOptions, logger *logging.Logger) *HTTPJobBuilder {
+	if opts.Retry.MaxAttempts < 1 {
+		opts.Retry.MaxAttempts = 1
+	}
+	if opts.Retry.MaxAttempts > 1 && opts.Retry.Delay <= 0 {
+		opts.Retry.Delay = DefaultRetryDelay
+	}
+	if opts.Retry.MaxDelay <= 0 {
+		opts.Retry.MaxDelay = DefaultRetryMaxDelay
+	}
+	if opts.Status.Success == nil {
+		opts.Status.Success = DefaultSuccessStatus
+	}
+	if opts.Status.Retry == nil {
+		opts.Status.Retry = DefaultRetryStatus
+	}
+
 	return &HTTPJobBuilder{
-		client:    newHTTPClient(timeout),
-		infLogger: infLogger,
+		client: newHTTPClient(opts.Timeout, opts.Guard),
+		opts:   opts,
+		logger: logger,
 	}
 }
 
-func newHTTPClient(timeout time.Duration) *http.Client {
+// newHTTPJobBuilderFromConfig uses circuits and limits of the shared state,
+// builder has its own ones when the state is nil.
+func newHTTPJobBuilderFromConfig(cfg *config.Config, state *State, logger *logging.Logger) (domain.JobBuilder, error) {
+	opts, err := httpOptionsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return NewHTTPJobBuilder(opts, logger), nil
+	}
+
+	jb := newHTTPJobBuilder(opts, logger)
+	jb.breakers, jb.limits = state.breakers, state.limits
+	return jb, nil
+}
+
+func httpOptionsFromConfig(cfg *config.Config) (HTTPOptions, error) {
+	success, err := ParseStatusRanges(cfg.Status.Success)
+	if err != nil {
+		return HTTPOptions{}, err
+	}
+	retry, err := ParseStatusRanges(cfg.Status.Retry)
+	if err != nil {
+		return HTTPOptions{}, err
+	}
+	status := StatusPolicy{
+		Success: success,
+		Retry:   retry,
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts: cfg.Retry.MaxAttempts,
+		Delay:       time.Duration(cfg.Retry.Delay) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.Retry.MaxDelay) * time.Millisecond,
+		Jitter:      cfg.Retry.Jitter,
+	}
+
+	switch cfg.Breaker.OnOpen {
+	case "", BreakerRequeue, BreakerRetry, BreakerReject:
+	default:
+		return HTTPOptions{}, fmt.Errorf("invalid breaker onopen value: %v", cfg.Breaker.OnOpen)
+	}
+
+	switch cfg.Limits.OnLimit {
+	case "", LimitWait, LimitRequeue, LimitRetry:
+	default:
+		return HTTPOptions{}, fmt.Errorf("invalid limits onlimit value: %v", cfg.Limits.OnLimit)
+	}
+	guard, err := NewGuard(GuardOptions{
+		Schemes:      cfg.Allow.Scheme,
+		Hosts:        cfg.Allow.Host,
+		Networks:     cfg.Allow.Network,
+		Paths:        cfg.Allow.Path,
+		AllowPrivate: cfg.Allow.Private,
+	})
+	if err != nil {
+		return HTTPOptions{}, err
+	}
+
+	prefixes := make(map[string]PrefixLimit, len(cfg.Limit))
+	for name, l := range cfg.Limit {
+		if l == nil || l.Prefix == "" {
+			return HTTPOptions{}, fmt.Errorf("empty prefix of limit %q", name)
+		}
+		prefixes[name] = PrefixLimit{
+			Prefix: l.Prefix,
+			LimitPolicy: LimitPolicy{
+				Rate:        l.Rate,
+				Burst:       l.Burst,
+				MaxInFlight: l.MaxInFlight,
+			},
+		}
+	}
+
+	// Failed messages are retried by the consumer via delay queues
+	if cfg.Retry.Mode == config.RetryModeQueue {
+		policy = RetryPolicy{MaxAttempts: 1}
+	}
+
+	return HTTPOptions{
+		Timeout:         time.Duration(cfg.Http.Timeout) * time.Millisecond,
+		Retry:           policy,
+		Status:          status,
+		ForwardMetadata: cfg.Http.ForwardMetadata,
+		Reply:           cfg.Rpc.Enabled,
+		ReplyHeaders:    cfg.Rpc.Header,
+		Breaker: BreakerPolicy{
+			Threshold: cfg.Breaker.Threshold,
+			Cooldown:  time.Duration(cfg.Breaker.Cooldown) * time.Millisecond,
+			OnOpen:    cfg.Breaker.OnOpen,
+		},
+		Limits: LimitOptions{
+			Host: LimitPolicy{
+				Rate:        cfg.Limits.Rate,
+				Burst:       cfg.Limits.Burst,
+				MaxInFlight: cfg.Limits.MaxInFlight,
+			},
+			Prefix:  prefixes,
+			OnLimit: cfg.Limits.OnLimit,
+		},
+		Guard: guard,
+	}, nil
+}
+
+func newHTTPClient(timeout time.Duration, guard *Guard) *http.Client {
 	dialer := &net.Dialer{
 		Timeout: timeout,
 	}
 	trans := &http.Transport{
-		Dial:                dialer.Dial,
+		DialContext:         dialer.DialContext,
 		TLSHandshakeTimeout: timeout,
 	}
-	return &http.Client{
+	client := &http.Client{
 		Timeout:   timeout,
 		Transport: trans,
 	}
+
+	if guard != nil {
+		trans.DialContext = guard.dialContext(dialer)
+		client.CheckRedirect = guard.checkRedirect
+	}
+	return client
 }
 
 type HTTPJobBuilder struct {
-	client    *http.Client
-	infLogger *log.Logger
+	client   *http.Client
+	opts     HTTPOptions
+	logger   *logging.Logger
+	breakers *breakers
+	limits   *limits
 }
 
-func (h *HTTPJobBuilder) BuildJob(data []byte) (domain.Job, error) {
+func (h *HTTPJobBuilder) BuildJob(m *domain.Message) (domain.Job, error) {
 	msg := httpMessagePool.Get().(*httpMessage)
 	defer httpMessagePool.Put(msg)
 
 	msg.reset()
-	if err := msg.parse(data); err != nil {
+	if err := msg.parse(m.Body); err != nil {
 		return nil, fmt.Errorf("could not parse message: %v", err)
 	}
 
@@ -70,10 +414,22 @@ func (h *HTTPJobBuilder) BuildJob(data []byte) (domain.Job, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not build http request: %v", err)
 	}
+	if err := h.opts.Guard.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	if h.opts.ForwardMetadata {
+		setMetadataHeaders(req.Header, m)
+	}
 
 	return &HTTPJob{
-		client: h.client,
-		req:    req,
+		client:       h.client,
+		req:          req,
+		retry:        h.opts.Retry.override(msg.RequestParams.Retry),
+		status:       h.opts.Status.override(msg.RequestParams.ExpectStatus, msg.RequestParams.RetryStatus),
+		reply:        h.opts.Reply,
+		replyHeaders: h.opts.ReplyHeaders,
+		breakers:     h.breakers,
+		limits:       h.limits,
 	}, nil
 }
 
@@ -85,10 +441,13 @@ var httpMessagePool = sync.Pool{
 
 type httpMessage struct {
 	RequestParams struct {
-		URI     string                 `json:"uri"`
-		Headers map[string]interface{} `json:"headers"`
-		Body    string                 `json:"body"`
-		Method  string                 `json:"method"`
+		URI          string                 `json:"uri"`
+		Headers      map[string]interface{} `json:"headers"`
+		Body         string                 `json:"body"`
+		Method       string                 `json:"method"`
+		Retry        *retryParams           `json:"retry"`
+		ExpectStatus []int                  `json:"expect_status"`
+		RetryStatus  []int                  `json:"retry_status"`
 	} `json:"request_params"`
 }
 
@@ -116,6 +475,9 @@ func (msg *httpMessage) reset() {
 	msg.RequestParams.Headers = nil
 	msg.RequestParams.Body = ""
 	msg.RequestParams.Method = ""
+	msg.RequestParams.Retry = nil
+	msg.RequestParams.ExpectStatus = nil
+	msg.RequestParams.RetryStatus = nil
 }
 
 func buildRequest(msg *httpMessage) (*http.Request, error) {
@@ -134,6 +496,35 @@ func buildRequest(msg *httpMessage) (*http.Request, error) {
 	return req, nil
 }
 
+const metadataHeaderPrefix = "X-Amqp-"
+
+// setMetadataHeaders forwards AMQP properties and headers of the message.
+func setMetadataHeaders(headers http.Header, m *domain.Message) {
+	set := func(key string, val string) {
+		if val != "" {
+			headers.Set(metadataHeaderPrefix+key, val)
+		}
+	}
+
+	set("Exchange", m.Exchange)
+	set("Routing-Key", m.RoutingKey)
+	set("Message-Id", m.MessageID)
+	set("Correlation-Id", m.CorrelationID)
+	set("Reply-To", m.ReplyTo)
+	set("Redelivered", strconv.FormatBool(m.Redelivered))
+	set("Priority", strconv.Itoa(int(m.Priority)))
+	if !m.Timestamp.IsZero() {
+		set("Timestamp", m.Timestamp.UTC().Format(time.RFC3339))
+	}
+
+	for k, v := range m.Headers {
+		switch v.(type) {
+		case string, bool, int8, int16, int32, int64, uint8, float32, float64:
+			set("Header-"+k, fmt.Sprint(v))
+		}
+	}
+}
+
 func buildHeaders(msg *httpMessage) (http.Header, error) {
 	if msg.RequestParams.Headers != nil {
 		headers := make(http.Header)
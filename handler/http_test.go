@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,6 +13,9 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
 )
 
 var (
@@ -66,7 +70,7 @@ func TestDoHttpRequest(t *testing.T) {
 		t.Fatalf("could not build http request: %v", err)
 	}
 
-	client := newHTTPClient(time.Second * 3)
+	client := newHTTPClient(time.Second*3, nil)
 	resp, err := client.Do(req)
 	if err != nil {
 		t.Fatalf("could not perform http request: %v", err)
@@ -195,3 +199,91 @@ X-User-Uuid: xxxdddsa-bdf7-4382-8cc4-351367c39e48
 		}
 	}
 }
+
+func TestSetMetadataHeaders(t *testing.T) {
+	msg := &domain.Message{
+		Headers:       map[string]interface{}{"tenant": "acme", "attempt": int32(2), "nested": map[string]interface{}{}},
+		RoutingKey:    "order.created",
+		MessageID:     "msg-1",
+		CorrelationID: "corr-1",
+		Redelivered:   true,
+		Timestamp:     time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC),
+		Priority:      5,
+	}
+
+	headers := make(http.Header)
+	setMetadataHeaders(headers, msg)
+
+	want := http.Header{
+		"X-Amqp-Routing-Key":    {"order.created"},
+		"X-Amqp-Message-Id":     {"msg-1"},
+		"X-Amqp-Correlation-Id": {"corr-1"},
+		"X-Amqp-Redelivered":    {"true"},
+		"X-Amqp-Priority":       {"5"},
+		"X-Amqp-Timestamp":      {"2018-01-01T12:00:00Z"},
+		"X-Amqp-Header-Tenant":  {"acme"},
+		"X-Amqp-Header-Attempt": {"2"},
+	}
+	if !reflect.DeepEqual(headers, want) {
+		t.Fatalf("invalid headers, got %v, want %v", headers, want)
+	}
+}
+
+func TestHTTPJobReply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "42")
+		w.Header().Set("X-Internal", "secret")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout:      time.Second,
+		Reply:        true,
+		ReplyHeaders: []string{"content-type", "x-request-id", "x-missing"},
+	}, logger)
+
+	cases := []struct {
+		uri    string
+		status domain.Status
+		code   int
+	}{
+		{uri: srv.URL, status: domain.StatusSuccess, code: http.StatusOK},
+		{uri: srv.URL + "/missing", status: domain.StatusPermanent, code: http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		job, err := jb.BuildJob(&domain.Message{Body: buildMsg(c.uri)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := job.Do(context.Background(), logger)
+		if res.Status != c.status || res.ReplyContentType != "application/json" {
+			t.Fatalf("invalid result, got %v %v", res.Status, res.ReplyContentType)
+		}
+		if res.Target != c.uri || res.Attempts != 1 || res.Code != c.code || string(res.Body) != `{"ok":true}` {
+			t.Fatalf("invalid outcome, got %v %v %v %s", res.Target, res.Attempts, res.Code, res.Body)
+		}
+
+		var reply httpReply
+		if err := json.Unmarshal(res.Reply, &reply); err != nil {
+			t.Fatal(err)
+		}
+		want := httpReply{
+			Status: c.code,
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+				"X-Request-Id": "42",
+			},
+			Body: `{"ok":true}`,
+		}
+		if !reflect.DeepEqual(reply, want) {
+			t.Fatalf("invalid reply, got %+v, want %+v", reply, want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
+)
+
+// Values of LimitOptions.OnLimit, what happens to a job when the limit of
+// its target is reached. Requeued messages are redelivered right away, the
+// consumer keeps spinning on them until the limit frees up, retry uses delay
+// queues in queue retry mode instead.
+const (
+	LimitWait    = "wait"    // wait for a free slot or token
+	LimitRequeue = "requeue" // requeue the message right away
+	LimitRetry   = "retry"   // configured failure handling, e.g. delay queue
+)
+
+var errLimited = errors.New("limit reached")
+
+type LimitPolicy struct {
+	// Rate is number of requests per second, zero means unlimited.
+	Rate  float64
+	Burst int
+	// MaxInFlight is number of concurrent requests, zero means unlimited.
+	MaxInFlight int
+}
+
+func (p LimitPolicy) enabled() bool {
+	return p.Rate > 0 || p.MaxInFlight > 0
+}
+
+type LimitOptions struct {
+	// Host limits every destination host on its own.
+	Host LimitPolicy
+	// Prefix limits requests by URL prefix, longest prefix wins over the
+	// host limit. Keys are names of the limits.
+	Prefix  map[string]PrefixLimit
+	OnLimit string
+}
+
+type PrefixLimit struct {
+	Prefix string
+	LimitPolicy
+}
+
+// limiter is token bucket together with semaphore of in-flight requests.
+type limiter struct {
+	name   string
+	label  string
+	prefix string
+	policy LimitPolicy
+	slots  chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(name string, policy LimitPolicy) *limiter {
+	if policy.Rate > 0 && policy.Burst <= 0 {
+		policy.Burst = int(math.Ceil(policy.Rate))
+	}
+
+	l := &limiter{
+		name:   name,
+		label:  name,
+		policy: policy,
+		tokens: float64(policy.Burst),
+		last:   time.Now(),
+	}
+	if policy.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, policy.MaxInFlight)
+	}
+	return l
+}
+
+// take takes a token when there is one, otherwise returns how long it
+// takes until the next one.
+func (l *limiter) take(now time.Time) time.Duration {
+	if l.policy.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens = math.Min(float64(l.policy.Burst), l.tokens+now.Sub(l.last).Seconds()*l.policy.Rate)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.policy.Rate * float64(time.Second))
+}
+
+// acquire waits for a free slot and a token, or fails with errLimited
+// right away when wait is false.
+func (l *limiter) acquire(ctx context.Context, wait bool) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if !wait {
+				return nil, errLimited
+			}
+			metrics.LimitWaits.Inc(l.label)
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+			metrics.HTTPInFlight.Add(-1, l.label)
+		}
+	}
+	if l.slots != nil {
+		metrics.HTTPInFlight.Add(1, l.label)
+	}
+
+	for {
+		d := l.take(time.Now())
+		if d == 0 {
+			return release, nil
+		}
+		if !wait {
+			release()
+			return nil, errLimited
+		}
+
+		metrics.LimitWaits.Inc(l.label)
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// limits finds limiter of the request target, per host limiters are
+// created on demand.
+type limits struct {
+	opts     LimitOptions
+	prefixes []*limiter
+
+	mu    sync.Mutex
+	hosts map[string]*limiter
+}
+
+func newLimits(opts LimitOptions, logger *logging.Logger) *limits {
+	ls := &limits{
+		opts:  opts,
+		hosts: make(map[string]*limiter),
+	}
+
+	for name, p := range opts.Prefix {
+		l := newLimiter(name, p.LimitPolicy)
+		l.prefix = prefixKey(p.Prefix)
+		ls.prefixes = append(ls.prefixes, l)
+		logger.Infof("using limit %v for %v, rate=%v, burst=%v, max in flight=%v ...", name, p.Prefix, p.Rate, p.Burst, p.MaxInFlight)
+	}
+	sort.Slice(ls.prefixes, func(i, j int) bool {
+		return len(ls.prefixes[i].prefix) > len(ls.prefixes[j].prefix)
+	})
+
+	if opts.Host.enabled() {
+		logger.Infof("using limit per host, rate=%v, burst=%v, max in flight=%v ...", opts.Host.Rate, opts.Host.Burst, opts.Host.MaxInFlight)
+	}
+	return ls
+}
+
+// hostKey is the key of per host limiters and circuits, hosts are case
+// insensitive.
+func hostKey(host string) string {
+	return strings.ToLower(host)
+}
+
+// targetKey is matched against prefixes of limits, it leaves out userinfo
+// and fragment of the target.
+func targetKey(u *url.URL) string {
+	key := u.Scheme + "://" + hostKey(u.Host) + u.EscapedPath()
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+func prefixKey(prefix string) string {
+	u, err := url.Parse(prefix)
+	if err != nil || u.Host == "" {
+		return prefix
+	}
+	return targetKey(u)
+}
+
+func (ls *limits) find(u *url.URL) *limiter {
+	target := targetKey(u)
+	for _, l := range ls.prefixes {
+		if strings.HasPrefix(target, l.prefix) {
+			return l
+		}
+	}
+
+	if !ls.opts.Host.enabled() {
+		return nil
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	host := hostKey(u.Host)
+	l, ok := ls.hosts[host]
+	if !ok {
+		l = newLimiter(host, ls.opts.Host)
+		l.label = metrics.HostLabel(host)
+		ls.hosts[host] = l
+	}
+	return l
+}
+
+// acquire returns function releasing the acquired slot, it fails with
+// errLimited when the limit is reached and jobs are not supposed to wait.
+func (ls *limits) acquire(ctx context.Context, u *url.URL, logger *logging.Logger) (func(), error) {
+	if ls == nil {
+		return func() {}, nil
+	}
+
+	l := ls.find(u)
+	if l == nil {
+		return func() {}, nil
+	}
+
+	wait := ls.opts.OnLimit == "" || ls.opts.OnLimit == LimitWait
+	release, err := l.acquire(ctx, wait)
+	if err == errLimited {
+		metrics.LimitRejections.Inc(l.label)
+		logger.With(logging.Fields{"limit": l.name}).Warnf("limit reached, giving up message with %v", ls.opts.OnLimit)
+	}
+	return release, err
+}
+
+func (ls *limits) limitedResult(host string) domain.Result {
+	err := fmt.Errorf("limit of %v reached", host)
+	if ls.opts.OnLimit == LimitRetry {
+		return domain.Retry(err)
+	}
+	return domain.Requeue(err)
+}
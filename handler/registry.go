@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+const DefaultHandler = "http"
+
+// Factory creates job builder from its section of the configuration, state
+// is shared by builders of all consumers and may be nil.
+type Factory func(cfg *config.Config, state *State, logger *logging.Logger) (domain.JobBuilder, error)
+
+var factories = make(map[string]Factory)
+
+// Register makes handler available under given name, it is meant to be
+// called from init functions of the handler implementations.
+func Register(name string, factory Factory) {
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("handler %v already registered", name))
+	}
+	factories[name] = factory
+}
+
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func New(name string, cfg *config.Config, state *State, logger *logging.Logger) (domain.JobBuilder, error) {
+	if name == "" {
+		name = DefaultHandler
+	}
+
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown handler %q, available handlers: %v", name, strings.Join(Names(), ", "))
+	}
+
+	jb, err := factory(cfg, state, logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not create %v handler: %v", name, err)
+	}
+	return jb, nil
+}
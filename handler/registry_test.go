@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jbub/rabbitmq-cli-consumer/config"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestNewHandler(t *testing.T) {
+	logger := logging.Discard()
+
+	cfg := &config.Config{}
+	jb, err := New("", cfg, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := jb.(*HTTPJobBuilder); !ok {
+		t.Fatalf("invalid default handler, got %T", jb)
+	}
+
+	cfg.Exec.Command = "/bin/true"
+	jb, err = New("exec", cfg, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := jb.(*ExecJobBuilder); !ok {
+		t.Fatalf("invalid exec handler, got %T", jb)
+	}
+}
+
+func TestNewHandlerUnknown(t *testing.T) {
+	logger := logging.Discard()
+
+	_, err := New("ftp", &config.Config{}, nil, logger)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if want := "available handlers: exec, http"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("invalid error, got %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryDelay is the base delay between attempts when none is
+// configured, it matches the default delay of queue retries.
+const DefaultRetryDelay = time.Second
+
+// DefaultRetryMaxDelay caps delays between attempts when no MaxDelay is
+// configured, the worker and its prefetch slot are held while waiting.
+const DefaultRetryMaxDelay = time.Second * 30
+
+type RetryPolicy struct {
+	MaxAttempts int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+type retryParams struct {
+	MaxAttempts *int     `json:"max_attempts"`
+	Delay       *int     `json:"delay"`
+	MaxDelay    *int     `json:"max_delay"`
+	Jitter      *float64 `json:"jitter"`
+}
+
+// override returns copy of the policy with values from the message applied,
+// delays in the message are in milliseconds. Messages can only make retries
+// less aggressive, values are clamped to the configured policy.
+func (p RetryPolicy) override(params *retryParams) RetryPolicy {
+	if params == nil {
+		return p
+	}
+
+	o := p
+	if params.MaxAttempts != nil && *params.MaxAttempts < p.MaxAttempts {
+		o.MaxAttempts = *params.MaxAttempts
+		if o.MaxAttempts < 1 {
+			o.MaxAttempts = 1
+		}
+	}
+	if params.Delay != nil {
+		o.Delay = clampDuration(time.Duration(*params.Delay)*time.Millisecond, p.Delay, p.MaxDelay)
+	}
+	if params.MaxDelay != nil {
+		o.MaxDelay = clampDuration(time.Duration(*params.MaxDelay)*time.Millisecond, o.Delay, p.MaxDelay)
+	}
+	if params.Jitter != nil && *params.Jitter >= 0 && *params.Jitter <= 1 {
+		o.Jitter = *params.Jitter
+	}
+	return o
+}
+
+func clampDuration(d time.Duration, min time.Duration, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		d = max
+	}
+	if d < min {
+		d = min
+	}
+	return d
+}
+
+// delay returns how long to wait before the next attempt, attempt starts at 1.
+// Retry-After of the response is preferred, everything is capped by MaxDelay.
+func (p RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return p.capDelay(d)
+		}
+	}
+
+	d := p.Delay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+	return p.capDelay(d)
+}
+
+func (p RetryPolicy) capDelay(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func parseRetryAfter(val string, now time.Time) (time.Duration, bool) {
+	if val == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(val); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		return t.Sub(now), true
+	}
+	return 0, false
+}
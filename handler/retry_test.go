@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		val  string
+		want time.Duration
+		ok   bool
+	}{
+		{val: "", ok: false},
+		{val: "abc", ok: false},
+		{val: "-1", ok: false},
+		{val: "120", want: time.Second * 120, ok: true},
+		{val: "Mon, 01 Jan 2018 12:00:30 GMT", want: time.Second * 30, ok: true},
+	}
+
+	for _, c := range cases {
+		got, ok := parseRetryAfter(c.val, now)
+		if ok != c.ok {
+			t.Fatalf("invalid ok for %q, got %v, want %v", c.val, ok, c.ok)
+		}
+		if got != c.want {
+			t.Fatalf("invalid delay for %q, got %v, want %v", c.val, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{
+		Delay:    time.Millisecond * 100,
+		MaxDelay: time.Second,
+		Jitter:   0.5,
+	}
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Millisecond * 100},
+		{attempt: 2, want: time.Millisecond * 200},
+		{attempt: 4, want: time.Millisecond * 800},
+		{attempt: 10, want: time.Second},
+	}
+
+	for _, c := range cases {
+		got := p.delay(c.attempt, nil)
+		if got < c.want/2 || got > c.want {
+			t.Fatalf("invalid delay for attempt %v, got %v, want between %v and %v", c.attempt, got, c.want/2, c.want)
+		}
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3600"}}}
+	if got := p.delay(1, resp); got != p.MaxDelay {
+		t.Fatalf("invalid retry after delay, got %v, want %v", got, p.MaxDelay)
+	}
+}
+
+func TestRetryPolicyOverride(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts: 3,
+		Delay:       time.Second,
+		MaxDelay:    time.Second * 10,
+	}
+
+	attempts := 2
+	delay := 5000
+	got := p.override(&retryParams{
+		MaxAttempts: &attempts,
+		Delay:       &delay,
+	})
+
+	if got.MaxAttempts != attempts {
+		t.Fatalf("invalid max attempts, got %v, want %v", got.MaxAttempts, attempts)
+	}
+	if want := time.Second * 5; got.Delay != want {
+		t.Fatalf("invalid delay, got %v, want %v", got.Delay, want)
+	}
+	if p.MaxAttempts != 3 || p.Delay != time.Second {
+		t.Fatalf("original policy modified, got %+v", p)
+	}
+}
+
+func TestRetryPolicyOverrideClamp(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts: 3,
+		Delay:       time.Second,
+		MaxDelay:    time.Second * 10,
+	}
+
+	attempts := 1000000
+	delay := 0
+	maxDelay := 3600000
+	got := p.override(&retryParams{
+		MaxAttempts: &attempts,
+		Delay:       &delay,
+		MaxDelay:    &maxDelay,
+	})
+	if got != p {
+		t.Fatalf("values should be clamped to the policy, got %+v, want %+v", got, p)
+	}
+
+	attempts = -1
+	if got := p.override(&retryParams{MaxAttempts: &attempts}); got.MaxAttempts != 1 {
+		t.Fatalf("invalid max attempts, got %v", got.MaxAttempts)
+	}
+}
+
+func TestRetryAfterDefaultCap(t *testing.T) {
+	jb := NewHTTPJobBuilder(HTTPOptions{Retry: RetryPolicy{MaxAttempts: 3}}, logging.Discard())
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"3600"}}}
+	if got := jb.opts.Retry.delay(1, resp); got != DefaultRetryMaxDelay {
+		t.Fatalf("invalid retry after delay, got %v, want %v", got, DefaultRetryMaxDelay)
+	}
+}
+
+func TestRetryDefaultDelay(t *testing.T) {
+	jb := NewHTTPJobBuilder(HTTPOptions{Retry: RetryPolicy{MaxAttempts: 3}}, logging.Discard())
+	if got := jb.opts.Retry.delay(1, nil); got != DefaultRetryDelay {
+		t.Fatalf("invalid default delay, got %v, want %v", got, DefaultRetryDelay)
+	}
+
+	jb = NewHTTPJobBuilder(HTTPOptions{Retry: RetryPolicy{MaxAttempts: 3, Delay: time.Millisecond}}, logging.Discard())
+	if got := jb.opts.Retry.delay(1, nil); got != time.Millisecond {
+		t.Fatalf("configured delay should be kept, got %v", got)
+	}
+}
+
+func TestDoRetry(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != `{"from":"jano","to":"palo"}` {
+			t.Errorf("invalid body on attempt %v, got %s", calls, body)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout: time.Second,
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Millisecond,
+		},
+	}, logger)
+
+	job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := job.Do(context.Background(), logger); res.Status != domain.StatusSuccess {
+		t.Fatalf("expected success, got %v", res.Err)
+	}
+	if calls != 3 {
+		t.Fatalf("invalid number of calls, got %v, want %v", calls, 3)
+	}
+
+	calls = 0
+	job, err = jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.(*HTTPJob).retry.MaxAttempts = 2
+	if res := job.Do(context.Background(), logger); res.Status != domain.StatusRetry {
+		t.Fatalf("expected retry, got %v", res.Status)
+	}
+	if calls != 2 {
+		t.Fatalf("invalid number of calls, got %v, want %v", calls, 2)
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout: time.Second,
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Minute,
+		},
+	}, logger)
+
+	job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if res := job.Do(ctx, logger); res.Status != domain.StatusRequeue {
+		t.Fatalf("expected requeue, got %v", res.Status)
+	}
+}
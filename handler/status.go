@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type statusClass int
+
+const (
+	statusSuccess statusClass = iota
+	statusRetry
+	statusPermanent
+)
+
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+func (r StatusRange) contains(code int) bool {
+	return code >= r.Min && code <= r.Max
+}
+
+type StatusRanges []StatusRange
+
+func (rs StatusRanges) contains(code int) bool {
+	for _, r := range rs {
+		if r.contains(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStatusRanges parses status codes in the form of 204, 200-299 or 2xx.
+func ParseStatusRanges(vals []string) (StatusRanges, error) {
+	var rs StatusRanges
+	for _, val := range vals {
+		r, err := parseStatusRange(strings.TrimSpace(val))
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+func parseStatusRange(val string) (StatusRange, error) {
+	if len(val) == 3 && strings.HasSuffix(strings.ToLower(val), "xx") {
+		class, err := strconv.Atoi(val[:1])
+		if err != nil || class < 1 || class > 5 {
+			return StatusRange{}, fmt.Errorf("invalid status range: %v", val)
+		}
+		return StatusRange{Min: class * 100, Max: class*100 + 99}, nil
+	}
+
+	parts := strings.SplitN(val, "-", 2)
+	min, err := parseStatusCode(parts[0])
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status range: %v", val)
+	}
+	max := min
+	if len(parts) == 2 {
+		max, err = parseStatusCode(parts[1])
+		if err != nil || max < min {
+			return StatusRange{}, fmt.Errorf("invalid status range: %v", val)
+		}
+	}
+	return StatusRange{Min: min, Max: max}, nil
+}
+
+func parseStatusCode(val string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return 0, err
+	}
+	if code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code: %v", code)
+	}
+	return code, nil
+}
+
+func statusCodes(codes []int) StatusRanges {
+	rs := make(StatusRanges, 0, len(codes))
+	for _, code := range codes {
+		rs = append(rs, StatusRange{Min: code, Max: code})
+	}
+	return rs
+}
+
+var (
+	DefaultSuccessStatus = StatusRanges{{Min: 200, Max: 399}}
+	DefaultRetryStatus   = StatusRanges{{Min: 429, Max: 429}, {Min: 502, Max: 504}}
+)
+
+// StatusPolicy classifies http response status codes, codes which are
+// neither success nor retry are permanent failures.
+type StatusPolicy struct {
+	Success StatusRanges
+	Retry   StatusRanges
+}
+
+func (p StatusPolicy) override(expect []int, retry []int) StatusPolicy {
+	if expect != nil {
+		p.Success = statusCodes(expect)
+	}
+	if retry != nil {
+		p.Retry = statusCodes(retry)
+	}
+	return p
+}
+
+func (p StatusPolicy) classify(code int) statusClass {
+	if p.Success.contains(code) {
+		return statusSuccess
+	}
+	if p.Retry.contains(code) {
+		return statusRetry
+	}
+	return statusPermanent
+}
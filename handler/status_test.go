@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jbub/rabbitmq-cli-consumer/domain"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	got, err := ParseStatusRanges([]string{"204", "200-299", "5xx", " 429 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := StatusRanges{
+		{Min: 204, Max: 204},
+		{Min: 200, Max: 299},
+		{Min: 500, Max: 599},
+		{Min: 429, Max: 429},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("invalid ranges, got %v, want %v", got, want)
+	}
+
+	for _, val := range []string{"", "abc", "99", "600", "300-200", "9xx", "2x"} {
+		if _, err := ParseStatusRanges([]string{val}); err == nil {
+			t.Fatalf("expected error for %q", val)
+		}
+	}
+}
+
+func TestStatusPolicyClassify(t *testing.T) {
+	p := StatusPolicy{
+		Success: DefaultSuccessStatus,
+		Retry:   DefaultRetryStatus,
+	}
+
+	cases := []struct {
+		code int
+		want statusClass
+	}{
+		{code: 200, want: statusSuccess},
+		{code: 302, want: statusSuccess},
+		{code: 400, want: statusPermanent},
+		{code: 429, want: statusRetry},
+		{code: 500, want: statusPermanent},
+		{code: 503, want: statusRetry},
+	}
+
+	for _, c := range cases {
+		if got := p.classify(c.code); got != c.want {
+			t.Fatalf("invalid class for %v, got %v, want %v", c.code, got, c.want)
+		}
+	}
+
+	p = p.override([]int{204}, []int{500})
+	if p.classify(200) != statusPermanent || p.classify(204) != statusSuccess || p.classify(500) != statusRetry {
+		t.Fatalf("invalid override, got %+v", p)
+	}
+}
+
+func TestDoPermanentFailure(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	logger := logging.Discard()
+	jb := NewHTTPJobBuilder(HTTPOptions{
+		Timeout: time.Second,
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Millisecond,
+		},
+	}, logger)
+
+	job, err := jb.BuildJob(&domain.Message{Body: buildMsg(srv.URL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := job.Do(context.Background(), logger)
+	if res.Status != domain.StatusPermanent {
+		t.Fatalf("expected permanent error, got %v", res.Status)
+	}
+	if calls != 1 {
+		t.Fatalf("invalid number of calls, got %v, want %v", calls, 1)
+	}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"os"
+	"sync"
+)
+
+// File is log file writer which can be reopened after it was moved by
+// external tools like logrotate, it is safe for concurrent use.
+type File struct {
+	mu   sync.Mutex
+	name string
+	file *os.File
+}
+
+func OpenFile(name string) (*File, error) {
+	file, err := openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{name: name, file: file}, nil
+}
+
+func openFile(name string) (*os.File, error) {
+	return os.OpenFile(name, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
+}
+
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Write(p)
+}
+
+// Reopen opens the file by its name again and closes the previous one,
+// writes keep going to the previous file when reopening fails.
+func (f *File) Reopen() error {
+	file, err := openFile(f.name)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	prev := f.file
+	f.file = file
+	f.mu.Unlock()
+
+	return prev.Close()
+}
+
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "info.log")
+	file, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	file.Write([]byte("first\n"))
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("second\n"))
+	if err := file.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("third\n"))
+
+	rotated, _ := ioutil.ReadFile(name + ".1")
+	if string(rotated) != "first\nsecond\n" {
+		t.Fatalf("invalid rotated file, got %q", rotated)
+	}
+	current, _ := ioutil.ReadFile(name)
+	if string(current) != "third\n" {
+		t.Fatalf("invalid current file, got %q", current)
+	}
+}
+
+func TestFileReopenConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := OpenFile(filepath.Join(dir, "info.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	logger, err := New(Options{Out: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.With(Fields{"worker": worker}).Infof("entry %v", j)
+			}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		if err := file.Reopen(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
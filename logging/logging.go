@@ -0,0 +1,205 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+func ParseLevel(val string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(val, name) {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("invalid log level: %v", val)
+}
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Fields map[string]interface{}
+
+type Options struct {
+	Level  Level
+	Format string
+	// Out receives debug and info entries.
+	Out io.Writer
+	// ErrOut receives warn and error entries.
+	ErrOut io.Writer
+}
+
+type output struct {
+	mu     sync.Mutex
+	opts   Options
+	buffer bytes.Buffer
+}
+
+// Logger writes leveled entries with fields, it is safe for concurrent use.
+type Logger struct {
+	out    *output
+	fields Fields
+}
+
+func New(opts Options) (*Logger, error) {
+	switch opts.Format {
+	case "":
+		opts.Format = FormatText
+	case FormatText, FormatJSON:
+	default:
+		return nil, fmt.Errorf("invalid log format: %v", opts.Format)
+	}
+	if opts.Out == nil {
+		opts.Out = os.Stdout
+	}
+	if opts.ErrOut == nil {
+		opts.ErrOut = os.Stderr
+	}
+	return &Logger{out: &output{opts: opts}}, nil
+}
+
+// Discard returns logger which writes nothing.
+func Discard() *Logger {
+	return &Logger{out: &output{opts: Options{Level: LevelError + 1, Out: ioutil.Discard, ErrOut: ioutil.Discard}}}
+}
+
+// With returns logger which adds fields to every entry.
+func (l *Logger) With(fields Fields) *Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &Logger{out: l.out, fields: merged}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.opts.Level
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(LevelInfo, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.log(LevelWarn, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+}
+
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(LevelError, format, args...)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+
+	o := l.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buffer.Reset()
+	if o.opts.Format == FormatJSON {
+		writeJSON(&o.buffer, now, level, msg, l.fields)
+	} else {
+		writeText(&o.buffer, now, level, msg, l.fields)
+	}
+
+	w := o.opts.Out
+	if level >= LevelWarn {
+		w = o.opts.ErrOut
+	}
+	w.Write(o.buffer.Bytes())
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeText(buf *bytes.Buffer, now time.Time, level Level, msg string, fields Fields) {
+	buf.WriteString(now.Format("2006/01/02 15:04:05"))
+	buf.WriteString(" ")
+	buf.WriteString(strings.ToUpper(level.String()))
+	buf.WriteString(" ")
+	buf.WriteString(msg)
+	for _, k := range sortedKeys(fields) {
+		fmt.Fprintf(buf, ", %v=%v", k, fields[k])
+	}
+	buf.WriteString("\n")
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["time"] = now.Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"time":  entry["time"],
+			"level": entry["level"],
+			"msg":   msg,
+			"error": fmt.Sprintf("could not encode log fields: %v", err),
+		})
+	}
+	buf.Write(data)
+	buf.WriteString("\n")
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]Level{
+		"debug": LevelDebug,
+		"INFO":  LevelInfo,
+		"Warn":  LevelWarn,
+		"error": LevelError,
+	}
+	for val, want := range cases {
+		level, err := ParseLevel(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if level != want {
+			t.Fatalf("invalid level for %v, got %v, want %v", val, level, want)
+		}
+	}
+
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Fatal("expected error for invalid level")
+	}
+}
+
+func TestNewInvalidFormat(t *testing.T) {
+	if _, err := New(Options{Format: "xml"}); err == nil {
+		t.Fatal("expected error for invalid format")
+	}
+}
+
+func TestLevels(t *testing.T) {
+	var out, errOut bytes.Buffer
+	logger, err := New(Options{Level: LevelInfo, Out: &out, ErrOut: &errOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Debugf("debug %v", 1)
+	logger.Infof("info %v", 2)
+	logger.Warnf("warn %v", 3)
+	logger.Errorf("error %v", 4)
+
+	if strings.Contains(out.String(), "debug 1") {
+		t.Fatalf("debug entry should be skipped, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "INFO info 2") {
+		t.Fatalf("missing info entry, got %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "WARN warn 3") || !strings.Contains(errOut.String(), "ERROR error 4") {
+		t.Fatalf("missing error entries, got %q", errOut.String())
+	}
+}
+
+func TestTextFields(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(Options{Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.With(Fields{"worker": 1}).With(Fields{"status": 200}).Infof("request sent")
+
+	if want := "INFO request sent, status=200, worker=1\n"; !strings.HasSuffix(out.String(), want) {
+		t.Fatalf("invalid entry, got %q, want suffix %q", out.String(), want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(Options{Format: FormatJSON, Out: &out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.With(Fields{
+		"worker":     2,
+		"message_id": "abc",
+		"error":      errors.New("failed"),
+	}).Infof("job %v", "done")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"level":      "info",
+		"msg":        "job done",
+		"worker":     float64(2),
+		"message_id": "abc",
+		"error":      "failed",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Fatalf("invalid %v, got %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["time"]; !ok {
+		t.Fatal("missing time")
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/codegangsta/cli"
@@ -11,6 +16,8 @@ import (
 	"github.com/jbub/rabbitmq-cli-consumer/config"
 	"github.com/jbub/rabbitmq-cli-consumer/consumer"
 	"github.com/jbub/rabbitmq-cli-consumer/handler"
+	"github.com/jbub/rabbitmq-cli-consumer/logging"
+	"github.com/jbub/rabbitmq-cli-consumer/metrics"
 )
 
 func main() {
@@ -37,6 +44,18 @@ func main() {
 			Name:  "http-timeout, t",
 			Value: time.Second * 5,
 		},
+		cli.StringFlag{
+			Name:  "handler",
+			Usage: "Optional handler type, if set will override config handler type",
+		},
+		cli.StringFlag{
+			Name:  "log-level",
+			Usage: "Optional log level (debug, info, warn, error), if set will override config log level",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Usage: "Optional log format (text, json), if set will override config log format",
+		},
 	}
 	app.Action = func(c *cli.Context) {
 		if c.String("configuration") == "" {
@@ -45,35 +64,108 @@ func main() {
 		}
 
 		verbose := c.Bool("verbose")
-		debugLogger := getDebugLogger(verbose)
 
 		cfg, err := config.LoadAndParse(c.String("configuration"))
 		if err != nil {
 			log.Fatalf("failed parsing configuration: %s\n", err)
 		}
 
-		errLogger, err := createLogger(cfg.Logs.Error, verbose, os.Stderr)
-		if err != nil {
-			log.Fatalf("failed creating error log: %s", err)
+		if c.String("log-level") != "" {
+			cfg.Logs.Level = c.String("log-level")
+		}
+		if c.String("log-format") != "" {
+			cfg.Logs.Format = c.String("log-format")
 		}
 
-		infLogger, err := createLogger(cfg.Logs.Info, verbose, os.Stdout)
+		logger, files, err := createLogger(cfg, verbose)
 		if err != nil {
-			log.Fatalf("failed creating info log: %s", err)
+			log.Fatalf("failed creating logger: %s", err)
 		}
 
 		if c.String("queue-name") != "" {
+			// Queues of consumer sections would silently win over the flag
+			if len(cfg.ConsumerNames()) > 0 {
+				logger.Fatalf("queue name can not be set when consumer sections are configured")
+			}
 			cfg.RabbitMq.Queue = c.String("queue-name")
 		}
 
-		httpTimeout := c.Duration("http-timeout")
-		jb := handler.NewHTTPJobBuilder(httpTimeout, infLogger)
-		cons, err := consumer.New(cfg, jb, httpTimeout, debugLogger, errLogger, infLogger)
+		if c.IsSet("http-timeout") || cfg.Http.Timeout == 0 {
+			cfg.Http.Timeout = int(c.Duration("http-timeout") / time.Millisecond)
+		}
+		httpTimeout := time.Duration(cfg.Http.Timeout) * time.Millisecond
+
+		if c.String("handler") != "" {
+			cfg.Handler.Type = c.String("handler")
+		}
+
+		session, err := consumer.Dial(cfg, logger)
 		if err != nil {
-			errLogger.Fatalf("failed creating consumer: %s", err)
+			logger.Fatalf("failed connecting: %s", err)
+		}
+		// Circuits and limits of targets are shared by all consumers
+		state, err := handler.NewState(cfg, logger)
+		if err != nil {
+			logger.Fatalf("failed creating handler state: %s", err)
+		}
+		cons, err := createConsumers(session, cfg, state, httpTimeout, logger)
+		if err != nil {
+			logger.Fatalf("failed creating consumer: %s", err)
+		}
+
+		// Metrics and health endpoints share the listener when addresses match
+		muxes := make(map[string]*http.ServeMux)
+		if cfg.Metrics.Listen != "" {
+			getServeMux(muxes, cfg.Metrics.Listen).Handle("/metrics", metrics.Handler())
+		}
+		if cfg.Health.Listen != "" {
+			mux := getServeMux(muxes, cfg.Health.Listen)
+			mux.Handle("/healthz", cons.HealthHandler())
+			mux.Handle("/readyz", cons.ReadyHandler())
+		}
+		for addr, mux := range muxes {
+			logger.Infof("serving http endpoints on %v ...", addr)
+			go func(addr string, mux *http.ServeMux) {
+				logger.Fatalf("failed serving http endpoints: %s", http.ListenAndServe(addr, mux))
+			}(addr, mux)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+		go func() {
+			sig := <-sigs
+			logger.Infof("received %v signal ...", sig)
+
+			// Second signal kills the process
+			signal.Stop(sigs)
+			cancel()
+		}()
+
+		// Log files are reopened after rotation by logrotate, empty list
+		// would subscribe to all signals
+		if len(reopenSignals) > 0 {
+			reopen := make(chan os.Signal, 1)
+			signal.Notify(reopen, reopenSignals...)
+			go func() {
+				for sig := range reopen {
+					for _, file := range files {
+						if err := file.Reopen(); err != nil {
+							logger.Errorf("could not reopen log file %v: %v", file.Name(), err)
+						}
+					}
+					logger.Infof("received %v signal, log files reopened", sig)
+				}
+			}()
 		}
 
-		cons.Consume()
+		err = cons.Consume(ctx)
+		session.Close()
+		if err != nil {
+			logger.Fatalf("failed consuming: %s", err)
+		}
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -81,24 +173,86 @@ func main() {
 	}
 }
 
-func createLogger(filename string, verbose bool, out io.Writer) (*log.Logger, error) {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
+// createConsumers creates one consumer per consumer section, the main
+// sections make up the only consumer when there are none.
+func createConsumers(session *consumer.Session, cfg *config.Config, state *handler.State, httpTimeout time.Duration, logger *logging.Logger) (consumer.Group, error) {
+	names := cfg.ConsumerNames()
+	if len(names) == 0 {
+		c, err := createConsumer(session, cfg, state, httpTimeout, logger)
+		if err != nil {
+			return nil, err
+		}
+		return consumer.Group{c}, nil
+	}
+
+	group := make(consumer.Group, 0, len(names))
+	for _, name := range names {
+		ccfg := cfg.ConsumerConfig(name)
+		c, err := createConsumer(session, ccfg, state, httpTimeout, logger.With(logging.Fields{
+			"consumer": name,
+			"queue":    ccfg.RabbitMq.Queue,
+		}))
+		if err != nil {
+			return nil, fmt.Errorf("consumer %v: %v", name, err)
+		}
+		group = append(group, c)
+	}
+	return group, nil
+}
+
+func createConsumer(session *consumer.Session, cfg *config.Config, state *handler.State, httpTimeout time.Duration, logger *logging.Logger) (*consumer.Consumer, error) {
+	jb, err := handler.New(cfg.Handler.Type, cfg, state, logger)
 	if err != nil {
 		return nil, err
 	}
+	return consumer.New(session, cfg, jb, httpTimeout, logger)
+}
+
+func getServeMux(muxes map[string]*http.ServeMux, addr string) *http.ServeMux {
+	mux, ok := muxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		muxes[addr] = mux
+	}
+	return mux
+}
 
-	var writers = []io.Writer{
-		file,
+func createLogger(cfg *config.Config, verbose bool) (*logging.Logger, []*logging.File, error) {
+	// Attempt to preserve BC here, verbose mode used to enable debug output
+	level := logging.LevelInfo
+	if cfg.Logs.Level != "" {
+		var err error
+		if level, err = logging.ParseLevel(cfg.Logs.Level); err != nil {
+			return nil, nil, err
+		}
+	} else if verbose {
+		level = logging.LevelDebug
 	}
-	if verbose {
-		writers = append(writers, out)
+
+	errFile, err := logging.OpenFile(cfg.Logs.Error)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create error log: %v", err)
+	}
+	infFile, err := logging.OpenFile(cfg.Logs.Info)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create info log: %v", err)
+	}
+
+	logger, err := logging.New(logging.Options{
+		Level:  level,
+		Format: cfg.Logs.Format,
+		Out:    createLogWriter(infFile, verbose, os.Stdout),
+		ErrOut: createLogWriter(errFile, verbose, os.Stderr),
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	return log.New(io.MultiWriter(writers...), "", log.Ldate|log.Ltime), nil
+	return logger, []*logging.File{errFile, infFile}, nil
 }
 
-func getDebugLogger(verbose bool) *log.Logger {
+func createLogWriter(file *logging.File, verbose bool, out io.Writer) io.Writer {
 	if verbose {
-		return log.New(os.Stdout, "", log.Ldate|log.Ltime)
+		return io.MultiWriter(file, out)
 	}
-	return nil
+	return file
 }
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var Default = NewRegistry()
+
+var (
+	MessagesReceived  = NewCounter(Default, "messages_received_total", "Number of messages received from RabbitMQ.")
+	JobsBuilt         = NewCounter(Default, "jobs_built_total", "Number of jobs built from messages.")
+	JobBuildFailures  = NewCounter(Default, "job_build_failures_total", "Number of messages which could not be built into jobs.")
+	JobDuration       = NewHistogram(Default, "job_duration_seconds", "Duration of jobs by result status.", DefaultBuckets, "status")
+	HTTPRequests      = NewCounter(Default, "http_requests_total", "Number of http requests by target host and status class.", "host", "class")
+	WorkersBusy       = NewGauge(Default, "workers_busy", "Number of workers running a job.")
+	WorkersIdle       = NewGauge(Default, "workers_idle", "Number of workers waiting for a job.")
+	JobQueueDepth     = NewGauge(Default, "job_queue_depth", "Number of jobs waiting in the job queue by consumed queue.", "queue")
+	Acks              = NewCounter(Default, "acks_total", "Number of acknowledged messages.")
+	Nacks             = NewCounter(Default, "nacks_total", "Number of negatively acknowledged messages.")
+	Rejects           = NewCounter(Default, "rejects_total", "Number of rejected messages.")
+	Reconnects        = NewCounter(Default, "reconnects_total", "Number of successful reconnects to RabbitMQ.")
+	HTTPInFlight      = NewGauge(Default, "http_in_flight", "Number of http requests in flight by limit.", "limit")
+	LimitWaits        = NewCounter(Default, "limit_waits_total", "Number of times a job waited for a limit.", "limit")
+	LimitRejections   = NewCounter(Default, "limit_rejections_total", "Number of jobs requeued because a limit was reached.", "limit")
+	BlockedRequests   = NewCounter(Default, "blocked_requests_total", "Number of requests to destinations which are not allowed by stage of the check.", "stage")
+	CircuitRejections = NewCounter(Default, "circuit_rejections_total", "Number of jobs failed fast because circuit of the target host was open.", "host")
+	Events            = NewCounter(Default, "events_total", "Number of result events by publish result.", "result")
+)
+
+// MaxHosts is number of distinct hosts with their own series, hosts come
+// from messages so further hosts share the OtherHost label value.
+const (
+	MaxHosts  = 100
+	OtherHost = "other"
+)
+
+var hosts = struct {
+	sync.Mutex
+	seen map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+// HostLabel returns label value of the host, it is lower cased and
+// replaced by OtherHost once MaxHosts hosts were seen.
+func HostLabel(host string) string {
+	host = strings.ToLower(strings.ToValidUTF8(host, "\uFFFD"))
+
+	hosts.Lock()
+	defer hosts.Unlock()
+	if _, ok := hosts.seen[host]; ok {
+		return host
+	}
+	if len(hosts.seen) >= MaxHosts {
+		return OtherHost
+	}
+	hosts.seen[host] = struct{}{}
+	return host
+}
+
+func Handler() http.Handler {
+	return Default
+}
+
+// StatusClass returns status class label like 2xx for http status code.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return string(rune('0'+code/100)) + "xx"
+}
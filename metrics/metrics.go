@@ -0,0 +1,290 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const namespace = "rabbitmq_cli_consumer"
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// Write writes all metrics in the Prometheus text exposition format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	r.Write(bw)
+	bw.Flush()
+}
+
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %v %v\n", d.name, d.help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", d.name, d.kind)
+}
+
+// key returns map key of the label values, values are quoted so any value
+// maps to a distinct key.
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %v expects %v label values, got %v", d.name, len(d.labels), len(values)))
+	}
+	var b strings.Builder
+	for _, val := range values {
+		b.WriteString(strconv.Quote(val))
+	}
+	return b.String()
+}
+
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	var pairs []string
+	for i, val := range values {
+		pairs = append(pairs, d.labels[i]+`="`+escape(val)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(val string) string {
+	return escaper.Replace(strings.ToValidUTF8(val, "\uFFFD"))
+}
+
+func formatFloat(val float64) string {
+	switch {
+	case math.IsInf(val, 1):
+		return "+Inf"
+	case math.IsInf(val, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(val, 'g', -1, 64)
+}
+
+type sample struct {
+	labels []string
+	val    float64
+}
+
+// values holds one float per label values combination.
+type values struct {
+	desc
+	mu   sync.Mutex
+	vals map[string]*sample
+}
+
+// newSamples returns samples map, metrics without labels are always
+// written.
+func newSamples(labels []string) map[string]*sample {
+	vals := make(map[string]*sample)
+	if len(labels) == 0 {
+		vals[""] = &sample{}
+	}
+	return vals
+}
+
+// sample returns sample of the label values, caller must hold the lock.
+func (v *values) sample(labels []string) *sample {
+	key := v.key(labels)
+	s, ok := v.vals[key]
+	if !ok {
+		s = &sample{labels: append([]string(nil), labels...)}
+		v.vals[key] = s
+	}
+	return s
+}
+
+func (v *values) add(delta float64, labels []string) {
+	v.mu.Lock()
+	v.sample(labels).val += delta
+	v.mu.Unlock()
+}
+
+func (v *values) set(val float64, labels []string) {
+	v.mu.Lock()
+	v.sample(labels).val = val
+	v.mu.Unlock()
+}
+
+func (v *values) get(labels []string) float64 {
+	key := v.key(labels)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.vals[key]; ok {
+		return s.val
+	}
+	return 0
+}
+
+func (v *values) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	for _, key := range sortedKeys(v.vals) {
+		s := v.vals[key]
+		fmt.Fprintf(w, "%v%v %v\n", v.name, v.labelPairs(s.labels), formatFloat(s.val))
+	}
+}
+
+func sortedKeys(m map[string]*sample) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type Counter struct {
+	values
+}
+
+func NewCounter(r *Registry, name string, help string, labels ...string) *Counter {
+	c := &Counter{values{desc: desc{name: namespace + "_" + name, help: help, kind: "counter", labels: labels}, vals: newSamples(labels)}}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.add(1, labels)
+}
+
+func (c *Counter) Value(labels ...string) float64 {
+	return c.get(labels)
+}
+
+type Gauge struct {
+	values
+}
+
+func NewGauge(r *Registry, name string, help string, labels ...string) *Gauge {
+	g := &Gauge{values{desc: desc{name: namespace + "_" + name, help: help, kind: "gauge", labels: labels}, vals: newSamples(labels)}}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Set(val float64, labels ...string) {
+	g.set(val, labels)
+}
+
+func (g *Gauge) Add(delta float64, labels ...string) {
+	g.add(delta, labels)
+}
+
+func (g *Gauge) Value(labels ...string) float64 {
+	return g.get(labels)
+}
+
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	vals    map[string]*histogramValue
+}
+
+func NewHistogram(r *Registry, name string, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: namespace + "_" + name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		vals:    make(map[string]*histogramValue),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(val float64, labels ...string) {
+	key := h.key(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, ok := h.vals[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), labels...), counts: make([]uint64, len(h.buckets))}
+		h.vals[key] = hv
+	}
+	for i, upper := range h.buckets {
+		if val <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.count++
+	hv.sum += val
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+
+	keys := make([]string, 0, len(h.vals))
+	for k := range h.vals {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		hv := h.vals[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelPairs(hv.labels, "le", formatFloat(upper)), hv.counts[i])
+		}
+		fmt.Fprintf(w, "%v_bucket%v %v\n", h.name, h.labelPairs(hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%v_sum%v %v\n", h.name, h.labelPairs(hv.labels), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%v_count%v %v\n", h.name, h.labelPairs(hv.labels), hv.count)
+	}
+}
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+
+	c := NewCounter(r, "requests_total", "Number of requests.", "host", "class")
+	c.Inc("example.com", "2xx")
+	c.Inc("example.com", "2xx")
+	c.Inc(`we"ird`, "5xx")
+
+	g := NewGauge(r, "busy", "Busy workers.")
+	g.Add(3)
+	g.Add(-1)
+
+	h := NewHistogram(r, "duration_seconds", "Duration.", []float64{0.1, 1}, "status")
+	h.Observe(0.05, "success")
+	h.Observe(0.5, "success")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	want := `# HELP rabbitmq_cli_consumer_requests_total Number of requests.
+# TYPE rabbitmq_cli_consumer_requests_total counter
+rabbitmq_cli_consumer_requests_total{host="example.com",class="2xx"} 2
+rabbitmq_cli_consumer_requests_total{host="we\"ird",class="5xx"} 1
+# HELP rabbitmq_cli_consumer_busy Busy workers.
+# TYPE rabbitmq_cli_consumer_busy gauge
+rabbitmq_cli_consumer_busy 2
+# HELP rabbitmq_cli_consumer_duration_seconds Duration.
+# TYPE rabbitmq_cli_consumer_duration_seconds histogram
+rabbitmq_cli_consumer_duration_seconds_bucket{status="success",le="0.1"} 1
+rabbitmq_cli_consumer_duration_seconds_bucket{status="success",le="1"} 2
+rabbitmq_cli_consumer_duration_seconds_bucket{status="success",le="+Inf"} 2
+rabbitmq_cli_consumer_duration_seconds_sum{status="success"} 0.55
+rabbitmq_cli_consumer_duration_seconds_count{status="success"} 2
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("invalid output, got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	cases := map[int]string{
+		200: "2xx",
+		404: "4xx",
+		503: "5xx",
+		42:  "unknown",
+	}
+	for code, want := range cases {
+		if got := StatusClass(code); got != want {
+			t.Fatalf("invalid class for %v, got %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestRegistryWriteSeparatorInValue(t *testing.T) {
+	r := NewRegistry()
+
+	c := NewCounter(r, "requests_total", "Number of requests.", "host", "class")
+	c.Inc("\xff", "error")
+	c.Inc("a\xffb", "error")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	want := `# HELP rabbitmq_cli_consumer_requests_total Number of requests.
+# TYPE rabbitmq_cli_consumer_requests_total counter
+rabbitmq_cli_consumer_requests_total{host="` + "�" + `",class="error"} 1
+rabbitmq_cli_consumer_requests_total{host="a` + "�" + `b",class="error"} 1
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("invalid output, got\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestHostLabel(t *testing.T) {
+	if got := HostLabel("Example.COM:8080"); got != "example.com:8080" {
+		t.Fatalf("invalid label, got %v", got)
+	}
+	for i := 0; i < MaxHosts; i++ {
+		HostLabel(fmt.Sprintf("host-%v", i))
+	}
+	if got := HostLabel("new.example.com"); got != OtherHost {
+		t.Fatalf("expected %v, got %v", OtherHost, got)
+	}
+	if got := HostLabel("example.com:8080"); got != "example.com:8080" {
+		t.Fatalf("seen host should keep its label, got %v", got)
+	}
+}
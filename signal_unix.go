@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make the process reopen its log files.
+var reopenSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1}
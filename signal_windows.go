@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reopenSignals is empty, log files are not rotated by signals on Windows.
+var reopenSignals []os.Signal